@@ -0,0 +1,151 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/validator"
+	"strconv"
+	"time"
+)
+
+// accountPurgeInterval is how often deleted accounts past their grace period
+// are anonymized.
+const accountPurgeInterval = time.Hour
+
+// exportCurrentUserHandler responds with a zip archive of everything stored
+// about the user, one JSON file per kind of data.
+func (app *application) exportCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sections, err := app.models.Exports.ForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, section := range sections {
+		var indented bytes.Buffer
+		err = json.Indent(&indented, section.Data, "", "\t")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		f, err := archive.Create(section.Name + ".json")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		_, err = indented.WriteTo(f)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("series-export-%d-%s.zip", user.ID, time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// deleteCurrentUserHandler deletes the user's account, which takes their
+// password. Logging in again within the grace period restores it; after that
+// the account is anonymized.
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.currentUser(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if user.ServiceAccount {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if !app.checkCurrentPassword(w, r, v, user, "password", input.Password) {
+		return
+	}
+
+	err = app.models.Users.SoftDelete(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.denylist.RevokeSubject(user.ID)
+	app.invalidatePermissions(user.ID)
+
+	app.logger.PrintInfo("account deleted", map[string]string{
+		"user_id": strconv.FormatInt(user.ID, 10),
+	})
+
+	purgeAt := user.DeletedAt.Add(app.config.accounts.deletionGrace)
+	env := envelope{
+		"message":  "your account was deleted; log in again before it is anonymized to restore it",
+		"purge_at": purgeAt,
+	}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeDeletedAccounts anonymizes accounts whose grace period has passed,
+// until ctx is cancelled.
+func (app *application) purgeDeletedAccounts(ctx context.Context) {
+	ticker := time.NewTicker(accountPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := app.models.Users.AnonymizeDeleted(time.Now().Add(-app.config.accounts.deletionGrace))
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		} else if n > 0 {
+			app.invalidatePermissions(0)
+			app.logger.PrintInfo("deleted accounts anonymized", map[string]string{
+				"count": strconv.Itoa(n),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
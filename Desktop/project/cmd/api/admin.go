@@ -0,0 +1,413 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/validator"
+	"strconv"
+)
+
+// audit records a change the authenticated administrator made to the user
+// with targetID, in the audit log and in the application log.
+func (app *application) audit(r *http.Request, action string, targetID int64, details map[string]any) error {
+	actorID := app.contextGetUser(r).ID
+	entry := &data.AuditEntry{
+		ActorID:      &actorID,
+		TargetUserID: &targetID,
+		Action:       action,
+		Details:      details,
+	}
+	err := app.models.Audit.Insert(entry)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("user account changed by admin", map[string]string{
+		"action":         action,
+		"actor_id":       strconv.FormatInt(actorID, 10),
+		"target_user_id": strconv.FormatInt(targetID, 10),
+	})
+	return nil
+}
+
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Search    string
+		Activated *bool
+		data.Filters
+	}
+	v := validator.New()
+
+	qs := r.URL.Query()
+	input.Search = app.readString(qs, "q", "")
+	switch activated := app.readString(qs, "activated", ""); activated {
+	case "":
+	case "true", "false":
+		input.Activated = new(bool)
+		*input.Activated = activated == "true"
+	default:
+		v.AddError("activated", "must be true or false")
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAll(input.Search, input.Activated, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	granted, err := app.models.Permissions.GetGrantedForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	permissions, err := app.permissions.Get(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"user": user, "roles": roles, "granted_permissions": granted, "permissions": permissions}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateUserActivationHandler activates or deactivates a user. Deactivated
+// users can still log in but no longer pass requireActivatedUser.
+func (app *application) updateUserActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Activated *bool `json:"activated"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Activated != nil, "activated", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	user.Activated = *input.Activated
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Signed tokens carry the activation state, so they must be reissued.
+	app.denylist.RevokeSubject(user.ID)
+	app.invalidatePermissions(user.ID)
+
+	action := data.AuditActionDeactivate
+	if user.Activated {
+		action = data.AuditActionActivate
+	}
+	err = app.audit(r, action, user.ID, map[string]any{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// grantPermissionsHandler gives a user permissions. Administrators can only
+// grant permissions they hold themselves.
+func (app *application) grantPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.changePermissions(w, r, true)
+}
+
+func (app *application) revokePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.changePermissions(w, r, false)
+}
+
+func (app *application) changePermissions(w http.ResponseWriter, r *http.Request, grant bool) {
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	all, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	held, err := app.requestPermissions(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for i, code := range input.Permissions {
+		input.Permissions[i] = data.CanonicalPermission(code)
+	}
+
+	v := validator.New()
+	v.Check(len(input.Permissions) > 0, "permissions", "must be provided")
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range input.Permissions {
+		v.Check(validator.In(code, all...), "permissions", "must only contain existing permission codes")
+		if grant {
+			v.Check(held.Include(code), "permissions", "must be a subset of your own permissions")
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	action := data.AuditActionRevokePermissions
+	if grant {
+		action = data.AuditActionGrantPermissions
+		err = app.models.Permissions.AddForUser(user.ID, input.Permissions...)
+	} else {
+		err = app.models.Permissions.RemoveForUser(user.ID, input.Permissions...)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Signed tokens carry the permissions, so they must be reissued.
+	app.denylist.RevokeSubject(user.ID)
+	app.invalidatePermissions(user.ID)
+
+	err = app.audit(r, action, user.ID, map[string]any{"permissions": input.Permissions})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetGrantedForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"granted_permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// assignRolesHandler gives a user roles. Administrators can only assign roles
+// whose permissions they hold themselves.
+func (app *application) assignRolesHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeRoles(w, r, true)
+}
+
+func (app *application) removeRolesHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeRoles(w, r, false)
+}
+
+func (app *application) changeRoles(w http.ResponseWriter, r *http.Request, assign bool) {
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	all, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	held, err := app.requestPermissions(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	roles := make(map[string]*data.Role, len(all))
+	for _, role := range all {
+		roles[role.Name] = role
+	}
+
+	v := validator.New()
+	v.Check(len(input.Roles) > 0, "roles", "must be provided")
+	v.Check(validator.Unique(input.Roles), "roles", "must not contain duplicate values")
+	for _, name := range input.Roles {
+		role, ok := roles[name]
+		v.Check(ok, "roles", "must only contain existing roles")
+		if ok && assign {
+			for _, code := range role.Permissions {
+				v.Check(held.Include(code), "roles", "must only grant permissions you hold yourself")
+			}
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	action := data.AuditActionRemoveRoles
+	if assign {
+		action = data.AuditActionAssignRoles
+		err = app.models.Roles.AddForUser(user.ID, input.Roles...)
+	} else {
+		err = app.models.Roles.RemoveForUser(user.ID, input.Roles...)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Signed tokens carry the permissions, so they must be reissued.
+	app.denylist.RevokeSubject(user.ID)
+	app.invalidatePermissions(user.ID)
+
+	err = app.audit(r, action, user.ID, map[string]any{"roles": input.Roles})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	names, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": names}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserID int
+		data.Filters
+	}
+	v := validator.New()
+
+	qs := r.URL.Query()
+	input.UserID = app.readInt(qs, "user_id", 0, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"id", "created_at", "-id", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Audit.GetAll(int64(input.UserID), input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit_log": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readUserParam loads the user named by the id route parameter, responding
+// and returning false when there is none.
+func (app *application) readUserParam(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
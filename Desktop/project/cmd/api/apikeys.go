@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/validator"
+	"time"
+)
+
+// createServiceAccountHandler creates a user that can only authenticate with
+// API keys. Administrators can only grant it permissions they hold themselves.
+func (app *application) createServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string   `json:"name"`
+		Email       string   `json:"email"`
+		Permissions []string `json:"permissions"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := &data.User{
+		Name:           input.Name,
+		Email:          input.Email,
+		Activated:      true,
+		ServiceAccount: true,
+	}
+
+	// Service accounts never log in with a password, so they get a random
+	// one nobody knows.
+	randomBytes := make([]byte, 32)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = user.Password.Set(base64.RawStdEncoding.EncodeToString(randomBytes))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	all, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	granted, err := app.requestPermissions(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for i, code := range input.Permissions {
+		input.Permissions[i] = data.CanonicalPermission(code)
+	}
+
+	v := validator.New()
+	data.ValidateUser(v, user)
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range input.Permissions {
+		v.Check(validator.In(code, all...), "permissions", "must only contain existing permission codes")
+		v.Check(granted.Include(code), "permissions", "must be a subset of your own permissions")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if len(input.Permissions) > 0 {
+		err = app.models.Permissions.AddForUser(user.ID, input.Permissions...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.audit(r, data.AuditActionCreateServiceAccount, user.ID, map[string]any{"permissions": input.Permissions})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readServiceAccount loads the service account named by the id parameter,
+// responding with 404 when there is none.
+func (app *application) readServiceAccount(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	if !user.ServiceAccount {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	return user, true
+}
+
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readServiceAccount(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := app.models.APIKeys.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createAPIKeyHandler issues a key for a service account. The response is the
+// only time the key itself is shown.
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readServiceAccount(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		AllowedIPs  []string   `json:"allowed_ips"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ownerPermissions, err := app.permissions.Get(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	key := &data.APIKey{
+		UserID:      user.ID,
+		Name:        input.Name,
+		Permissions: input.Permissions,
+		AllowedIPs:  input.AllowedIPs,
+		Expiry:      input.Expiry,
+	}
+
+	v := validator.New()
+	if data.ValidateAPIKey(v, key, ownerPermissions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.APIKeys.Insert(key)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAPIKeyName):
+			v.AddError("name", "the service account already has a key with this name")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.audit(r, data.AuditActionCreateAPIKey, user.ID, map[string]any{
+		"api_key_id":  key.ID,
+		"name":        key.Name,
+		"prefix":      key.Prefix,
+		"permissions": key.Permissions,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	key, err := app.models.APIKeys.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.audit(r, data.AuditActionRevokeAPIKey, key.UserID, map[string]any{
+		"api_key_id": key.ID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "api key successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/filter"
+	"series.bekarysrymkhanov.net/internal/jsonlog"
+	"series.bekarysrymkhanov.net/internal/validator"
+	"time"
+)
+
+// newContentFilter builds the filter for new comments and the one for edits,
+// which leaves out duplicate and flood detection: an edit is not a new post,
+// and often re-sends the text it already had.
+func newContentFilter(cfg config, logger *jsonlog.Logger) (comments, edits filter.ContentFilter, err error) {
+	var chain filter.Chain
+
+	if cfg.filter.wordList != "" {
+		action, err := filter.ParseAction(cfg.filter.wordListAction)
+		if err != nil {
+			return nil, nil, err
+		}
+		wordList, err := filter.NewWordListFilter(cfg.filter.wordList, action)
+		if err != nil {
+			return nil, nil, err
+		}
+		go wordList.Watch(10*time.Second, func(err error) {
+			logger.PrintError(err, map[string]string{"filter": "wordlist"})
+		})
+		chain = append(chain, wordList)
+	}
+
+	linksAction, err := filter.ParseAction(cfg.filter.linksAction)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain = append(chain, filter.NewLinkFilter(cfg.filter.maxLinks, linksAction))
+	editChain := append(filter.Chain{}, chain...)
+
+	duplicateAction, err := filter.ParseAction(cfg.filter.duplicateAction)
+	if err != nil {
+		return nil, nil, err
+	}
+	floodAction, err := filter.ParseAction(cfg.filter.floodAction)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain = append(chain, filter.NewFloodFilter(cfg.filter.floodWindow, cfg.filter.floodMax, duplicateAction, floodAction))
+
+	return chain, editChain, nil
+}
+
+// filterComment runs the comment text through the content filter f.
+// Rejections are reported on v; masked text and flags are applied to the
+// comment.
+func (app *application) filterComment(f filter.ContentFilter, v *validator.Validator, likeComment *data.LikeComment) {
+	verdict := f.Check(filter.Content{
+		UserID: likeComment.UserID,
+		Text:   likeComment.CommentText,
+	})
+
+	switch verdict.Action {
+	case filter.ActionReject:
+		v.AddError("comment_text", verdict.Reason)
+	case filter.ActionFlag:
+		likeComment.CommentText = verdict.Text
+		if likeComment.Status != data.CommentStatusHidden {
+			likeComment.Status = data.CommentStatusFlagged
+		}
+	case filter.ActionMask:
+		likeComment.CommentText = verdict.Text
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"context"
 	"net/http"
 	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/jwt"
 )
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey   = contextKey("user")
+	tokenContextKey  = contextKey("token")
+	claimsContextKey = contextKey("claims")
+	apiKeyContextKey = contextKey("api_key")
+	scopesContextKey = contextKey("scopes")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -22,3 +29,51 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+func (app *application) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// contextGetToken returns the bearer token the request was authenticated
+// with, or an empty string for anonymous requests.
+func (app *application) contextGetToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
+
+func (app *application) contextSetClaims(r *http.Request, claims *jwt.Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+	return r.WithContext(ctx)
+}
+
+// contextGetClaims returns the claims of the signed access token the request
+// was authenticated with, or nil for any other request.
+func (app *application) contextGetClaims(r *http.Request) *jwt.Claims {
+	claims, _ := r.Context().Value(claimsContextKey).(*jwt.Claims)
+	return claims
+}
+
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey returns the API key the request was authenticated with, or
+// nil for any other request.
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+func (app *application) contextSetScopes(r *http.Request, scopes data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), scopesContextKey, scopes)
+	return r.WithContext(ctx)
+}
+
+// contextGetScopes returns the scopes the OAuth access token the request was
+// authenticated with was granted, or nil for any other request.
+func (app *application) contextGetScopes(r *http.Request) data.Permissions {
+	scopes, _ := r.Context().Value(scopesContextKey).(data.Permissions)
+	return scopes
+}
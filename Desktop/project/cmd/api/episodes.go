@@ -68,6 +68,12 @@ func (app *application) showEpisodeHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	episode.Reactions, err = app.models.Reactions.Summary(data.ReactionTargetEpisode, episode.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"episode": episode}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -187,7 +193,7 @@ func (app *application) listEpisodesHandler(w http.ResponseWriter, r *http.Reque
 
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "favorites", "-id", "-title", "-year", "-runtime", "-favorites"}
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
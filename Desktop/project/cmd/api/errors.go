@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -63,6 +65,11 @@ func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *htt
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
+func (app *application) accountLockedResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	message := "too many failed login attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", "Bearer")
 	message := "invalid or missing authentication token"
@@ -77,7 +84,33 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	message := "your user account must be activated to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+func (app *application) editWindowExpiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this comment can no longer be edited"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+func (app *application) bannedAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account has been banned"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+func (app *application) twoFactorRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must have two-factor authentication enabled to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+func (app *application) twoFactorAlreadyEnabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "two-factor authentication is already enabled for your user account"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+func (app *application) oauthErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+	headers.Set("Pragma", "no-cache")
+	err := app.writeJSON(w, status, envelope{"error": code, "error_description": description}, headers)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
 }
\ No newline at end of file
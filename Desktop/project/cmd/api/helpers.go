@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"series.bekarysrymkhanov.net/internal/validator"
@@ -127,3 +128,23 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 	return i
 }
+
+// background queues fn on the job runner. Tasks that cannot be queued are
+// dropped and logged, so callers never block on a busy runner.
+func (app *application) background(name string, fn func()) {
+	err := app.jobs.Submit(name, fn)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"task": name,
+		})
+	}
+}
+
+// clientIP returns the IP address the request came from.
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
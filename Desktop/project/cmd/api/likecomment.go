@@ -6,13 +6,82 @@ import (
 	"net/http"
 	"series.bekarysrymkhanov.net/internal/data"
 	"series.bekarysrymkhanov.net/internal/validator"
+	"time"
 )
 
+// isCommentModerator reports whether the request may use comments:moderate,
+// which API keys and tokens with narrower permissions than their owner may
+// not.
+func (app *application) isCommentModerator(r *http.Request) (bool, error) {
+	if app.contextGetUser(r).IsAnonymous() {
+		return false, nil
+	}
+	permissions, err := app.requestPermissions(r)
+	if err != nil {
+		return false, err
+	}
+	return permissions.Include("comments:moderate"), nil
+}
+
+// canModifyComment reports whether the request may delete the comment or see
+// its edit history: only its author or a holder of comments:moderate may.
+func (app *application) canModifyComment(r *http.Request, likeComment *data.LikeComment) (bool, error) {
+	if likeComment.IsAuthor(app.contextGetUser(r)) {
+		return true, nil
+	}
+	return app.isCommentModerator(r)
+}
+
+// logModeratorChange records in the moderation log that a moderator edited or
+// deleted a comment of another user. Changes by the author are not logged.
+func (app *application) logModeratorChange(r *http.Request, likeComment *data.LikeComment, action string) error {
+	moderator := app.contextGetUser(r)
+	if likeComment.IsAuthor(moderator) {
+		return nil
+	}
+
+	err := app.models.Moderation.LogAction(&data.ModerationAction{
+		ModeratorID: moderator.ID,
+		CommentID:   int64(likeComment.LikeID),
+		AuthorID:    likeComment.UserID,
+		Action:      action,
+	})
+	if err != nil {
+		return err
+	}
+	app.logger.PrintInfo("comment moderated", map[string]string{
+		"action":       action,
+		"comment_id":   fmt.Sprint(likeComment.LikeID),
+		"author_id":    fmt.Sprint(likeComment.UserID),
+		"moderator_id": fmt.Sprint(moderator.ID),
+	})
+	return nil
+}
+
+// checkSpoilerEpisode makes sure a spoiler comment points at an existing
+// episode other than its own one.
+func (app *application) checkSpoilerEpisode(v *validator.Validator, likeComment *data.LikeComment) error {
+	if likeComment.SpoilerEpisodeID == nil || *likeComment.SpoilerEpisodeID == int64(likeComment.EpisodeID) {
+		return nil
+	}
+	_, err := app.models.Movies.Get(*likeComment.SpoilerEpisodeID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("spoiler_episode_id", "must reference an existing episode")
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
 func (app *application) createLikeCommentHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		UserID      int    `json:"user_id"`
-		EpisodeID   int    `json:"episode_id"`
-		CommentText string `json:"comment_text"`
+		EpisodeID        int    `json:"episode_id"`
+		ParentID         *int64 `json:"parent_id"`
+		Spoiler          bool   `json:"spoiler"`
+		SpoilerEpisodeID *int64 `json:"spoiler_episode_id"`
+		CommentText      string `json:"comment_text"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -21,14 +90,55 @@ func (app *application) createLikeCommentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	user := app.contextGetUser(r)
+
 	v := validator.New()
 	likeComment := &data.LikeComment{
-		UserID:      input.UserID,
-		EpisodeID:   input.EpisodeID,
-		CommentText: input.CommentText,
+		UserID: user.ID,
+		Author: data.CommentAuthor{
+			ID:     user.ID,
+			Name:   user.Name,
+			Avatar: user.Avatar,
+		},
+		EpisodeID:        input.EpisodeID,
+		ParentID:         input.ParentID,
+		SpoilerEpisodeID: input.SpoilerEpisodeID,
+		CommentText:      input.CommentText,
+	}
+	if input.Spoiler && likeComment.SpoilerEpisodeID == nil {
+		episodeID := int64(input.EpisodeID)
+		likeComment.SpoilerEpisodeID = &episodeID
 	}
 
-	if data.ValidateLike(v, likeComment); !v.Valid() {
+	if data.ValidateLike(v, likeComment, app.config.comments.maxLength); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.checkSpoilerEpisode(v, likeComment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var parent *data.LikeComment
+	if input.ParentID != nil {
+		parent, err = app.models.LikeComment.Get(*input.ParentID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		v.Check(parent != nil && parent.EpisodeID == input.EpisodeID && parent.Status != data.CommentStatusHidden, "parent_id", "must reference a comment on the same episode")
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+	if app.filterComment(app.contentFilter, v, likeComment); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -38,8 +148,10 @@ func (app *application) createLikeCommentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	app.notifyForComment(likeComment, parent)
+
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/like/%d", likeComment.LikeID))
+	headers.Set("Location", fmt.Sprintf("/comments/%d", likeComment.LikeID))
 	err = app.writeJSON(w, http.StatusCreated, envelope{"like": likeComment}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -63,10 +175,22 @@ func (app *application) updateLikeCommentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	user := app.contextGetUser(r)
+	moderator, err := app.isCommentModerator(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !likeComment.IsAuthor(user) && !moderator {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	var input struct {
-		CommentText *string `json:"comment_text"`
-		LikeCount   *int    `json:"like_count"`
-		Version     *int    `json:"-"`
+		CommentText      *string `json:"comment_text"`
+		Spoiler          *bool   `json:"spoiler"`
+		SpoilerEpisodeID *int64  `json:"spoiler_episode_id"`
+		Version          *int    `json:"version"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -75,20 +199,57 @@ func (app *application) updateLikeCommentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if input.Version != nil && *input.Version != likeComment.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	if input.CommentText != nil && !moderator && time.Since(likeComment.CreatedAt) > app.config.comments.editWindow {
+		app.editWindowExpiredResponse(w, r)
+		return
+	}
+
+	// Text sent back unchanged, as clients do when changing only the spoiler
+	// settings, has already been filtered.
+	textChanged := input.CommentText != nil && *input.CommentText != likeComment.CommentText
 	if input.CommentText != nil {
 		likeComment.CommentText = *input.CommentText
 	}
-	if input.LikeCount != nil {
-		likeComment.LikeCount = *input.LikeCount
+	if input.SpoilerEpisodeID != nil {
+		likeComment.SpoilerEpisodeID = input.SpoilerEpisodeID
+	}
+	if input.Spoiler != nil {
+		switch {
+		case !*input.Spoiler:
+			likeComment.SpoilerEpisodeID = nil
+		case likeComment.SpoilerEpisodeID == nil:
+			episodeID := int64(likeComment.EpisodeID)
+			likeComment.SpoilerEpisodeID = &episodeID
+		}
 	}
 
 	v := validator.New()
-	if data.ValidateLike(v, likeComment); !v.Valid() {
+	if data.ValidateLike(v, likeComment, app.config.comments.maxLength); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.checkSpoilerEpisode(v, likeComment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	if textChanged {
+		if app.filterComment(app.editFilter, v, likeComment); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
 
-	err = app.models.LikeComment.Update(likeComment)
+	err = app.models.LikeComment.Update(likeComment, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -99,6 +260,12 @@ func (app *application) updateLikeCommentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	err = app.logModeratorChange(r, likeComment, data.ModerationActionEdit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"likeComment": likeComment}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -123,12 +290,76 @@ func (app *application) showLikeHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if likeComment.Status == data.CommentStatusHidden {
+		moderator, err := app.isCommentModerator(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !moderator {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+
+	err = app.redactSpoilers(app.contextGetUser(r), likeComment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.attachCommentReactions(app.contextGetUser(r), likeComment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"likeComment": likeComment}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+func (app *application) showCommentHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	likeComment, err := app.models.LikeComment.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	allowed, err := app.canModifyComment(r, likeComment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !allowed {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	revisions, err := app.models.LikeComment.GetRevisions(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"likeComment": likeComment, "revisions": revisions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) deleteLikeCommentHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(w, r)
 	if err != nil {
@@ -136,6 +367,27 @@ func (app *application) deleteLikeCommentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	likeComment, err := app.models.LikeComment.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	allowed, err := app.canModifyComment(r, likeComment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !allowed {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	err = app.models.LikeComment.Delete(id)
 	if err != nil {
 		switch {
@@ -147,6 +399,12 @@ func (app *application) deleteLikeCommentHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	err = app.logModeratorChange(r, likeComment, data.ModerationActionDelete)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "likeComment successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -165,14 +423,32 @@ func (app *application) listLikeHandler(w http.ResponseWriter, r *http.Request)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "user_id", "episode_id", "like_count", "comment_text", "-id", "-user_id", "-episode_id", "-like_count", "comment_text"}
+	input.Filters.SortSafelist = []string{"id", "user_id", "episode_id", "like_count", "comment_text", "reactions", "-id", "-user_id", "-episode_id", "-like_count", "-comment_text", "-reactions"}
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	likes, metadata, err := app.models.LikeComment.GetAll(input.CommentText, input.Filters)
+	moderator, err := app.isCommentModerator(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	likes, metadata, err := app.models.LikeComment.GetAll(input.CommentText, moderator, app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.redactSpoilers(app.contextGetUser(r), likes...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.attachCommentReactions(app.contextGetUser(r), likes...)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -194,22 +470,44 @@ func (app *application) listLikeByEpisodeIdHandler(w http.ResponseWriter, r *htt
 
 	// Read the query parameters for pagination and sorting
 	var input struct {
+		Window string
 		data.Filters
 	}
 	v := validator.New()
 	qs := r.URL.Query()
+	input.Window = app.readString(qs, "window", "all")
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "user_id", "like_count", "comment_text", "created_at", "-id", "-user_id", "-like_count", "-comment_text", "-created_at"}
+	input.Filters.SortSafelist = []string{"id", "user_id", "like_count", "comment_text", "created_at", "reactions", "-id", "-user_id", "-like_count", "-comment_text", "-created_at", "-reactions", "hot", "top", "controversial", "new"}
 
+	v.Check(validator.In(input.Window, commentWindows...), "window", "must be one of day, week, month, year or all")
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	// Hidden comments are only listed for moderators
+	moderator, err := app.isCommentModerator(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// Get the likes and comments for the episode
-	likes, metadata, err := app.models.LikeComment.GetAllByEpisodeID(episodeID, input.Filters)
+	likes, metadata, err := app.models.LikeComment.GetAllByEpisodeID(episodeID, moderator, commentWindowStart(input.Window), input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.redactSpoilers(app.contextGetUser(r), likes...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.attachCommentReactions(app.contextGetUser(r), likes...)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -221,3 +519,92 @@ func (app *application) listLikeByEpisodeIdHandler(w http.ResponseWriter, r *htt
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+var commentWindows = []string{"day", "week", "month", "year", "all"}
+
+// commentWindowStart returns the earliest creation time of the comments listed
+// for a window; the zero time for "all".
+func commentWindowStart(window string) time.Time {
+	now := time.Now()
+	switch window {
+	case "day":
+		return now.AddDate(0, 0, -1)
+	case "week":
+		return now.AddDate(0, 0, -7)
+	case "month":
+		return now.AddDate(0, -1, 0)
+	case "year":
+		return now.AddDate(-1, 0, 0)
+	default:
+		return time.Time{}
+	}
+}
+
+func (app *application) voteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Value int `json:"value"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateVote(v, input.Value); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	likeComment, err := app.models.LikeComment.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if likeComment.Status == data.CommentStatusHidden {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.LikeComment.Vote(id, app.contextGetUser(r).ID, input.Value)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "vote recorded"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCommentVoteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.LikeComment.DeleteVote(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "vote removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/validator"
+	"strconv"
+	"time"
+)
+
+// loginFailurePurgeInterval is how often failures that would no longer be
+// counted are deleted.
+const loginFailurePurgeInterval = time.Hour
+
+// loginLocked responds and returns true when logins for email are refused,
+// either because of the backoff after recent failures or a lockout.
+func (app *application) loginLocked(w http.ResponseWriter, r *http.Request, email string) bool {
+	failures, err := app.models.LoginFailures.Get(email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return true
+	}
+
+	now := time.Now()
+	if failures.Locked(now) {
+		app.accountLockedResponse(w, r, failures.LockedUntil.Sub(now))
+		return true
+	}
+	return false
+}
+
+// loginBackoff returns how long logins for an account are refused after its
+// nth consecutive failure.
+func (app *application) loginBackoff(failures int) time.Duration {
+	cfg := app.config.login
+	switch {
+	case failures >= cfg.lockoutAfter:
+		return cfg.lockoutDuration
+	case failures < cfg.backoffAfter:
+		return 0
+	}
+
+	backoff := cfg.backoffBase
+	for i := cfg.backoffAfter; i < failures && backoff < cfg.lockoutDuration; i++ {
+		backoff *= 2
+	}
+	return min(backoff, cfg.lockoutDuration)
+}
+
+// loginFailed counts a failed login for email and responds with invalid
+// credentials. user is nil when there is no account with that email, which is
+// counted all the same so that the responses don't tell the cases apart.
+func (app *application) loginFailed(w http.ResponseWriter, r *http.Request, email string, user *data.User) {
+	err := app.recordLoginFailure(r, email, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.invalidCredentialsResponse(w, r)
+}
+
+// recordLoginFailure counts a failed login for email, locking logins for it
+// once there were too many.
+func (app *application) recordLoginFailure(r *http.Request, email string, user *data.User) error {
+	cfg := app.config.login
+	failures, err := app.models.LoginFailures.RecordFailure(email, time.Now().Add(-cfg.failureWindow), cfg.lockoutAfter)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("login failed", map[string]string{
+		"email":    email,
+		"ip":       app.clientIP(r),
+		"failures": strconv.Itoa(failures),
+	})
+
+	if backoff := app.loginBackoff(failures); backoff > 0 {
+		lockedUntil := time.Now().Add(backoff)
+		err = app.models.LoginFailures.Lock(email, lockedUntil)
+		if err != nil {
+			return err
+		}
+
+		if failures >= cfg.lockoutAfter {
+			app.logger.PrintInfo("account locked", map[string]string{
+				"email":        email,
+				"ip":           app.clientIP(r),
+				"locked_until": lockedUntil.Format(time.RFC3339),
+			})
+			if user != nil {
+				err = app.sendUnlockEmail(user, lockedUntil)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkCurrentPassword verifies the password of the signed-in user before a
+// sensitive change, responding and returning false unless it matches. Wrong
+// passwords count as failed logins, so that a stolen session cannot be used
+// to guess it.
+func (app *application) checkCurrentPassword(w http.ResponseWriter, r *http.Request, v *validator.Validator, user *data.User, field, password string) bool {
+	if app.loginLocked(w, r, user.Email) {
+		return false
+	}
+
+	match, err := user.Password.Matches(password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if !match {
+		err = app.recordLoginFailure(r, user.Email, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return false
+		}
+		v.AddError(field, "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	return true
+}
+
+// loginSucceeded forgets the failed logins of the user.
+func (app *application) loginSucceeded(r *http.Request, user *data.User) error {
+	err := app.models.LoginFailures.Reset(user.Email)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("login succeeded", map[string]string{
+		"user_id": strconv.FormatInt(user.ID, 10),
+		"ip":      app.clientIP(r),
+	})
+	return nil
+}
+
+// sendUnlockEmail mails the user a token that lifts the lockout of their
+// account before it expires on its own.
+func (app *application) sendUnlockEmail(user *data.User, lockedUntil time.Time) error {
+	token, err := app.models.Tokens.New(user.ID, time.Until(lockedUntil), data.ScopeUnlock)
+	if err != nil {
+		return err
+	}
+
+	app.background("send account unlock email", func() {
+		data := map[string]any{
+			"name":        user.Name,
+			"unlockToken": token.Plaintext,
+			"lockedUntil": lockedUntil.Format(time.RFC1123),
+		}
+
+		err := app.mailer.Send(user.Email, "account_unlock.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+	return nil
+}
+
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeUnlock, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired unlock token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.unlockUser(r, user, "email")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account was unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adminUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.unlockUser(r, user, "admin")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.audit(r, data.AuditActionUnlock, user.ID, map[string]any{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "account unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unlockUser(r *http.Request, user *data.User, by string) error {
+	err := app.models.LoginFailures.Reset(user.Email)
+	if err != nil {
+		return err
+	}
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeUnlock, user.ID)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("account unlocked", map[string]string{
+		"user_id": strconv.FormatInt(user.ID, 10),
+		"by":      by,
+		"ip":      app.clientIP(r),
+	})
+	return nil
+}
+
+// purgeLoginFailures deletes the failures that have passed the failure window
+// and hold no lock, until ctx is cancelled. Without it, every address ever
+// tried, known or not, would keep a row.
+func (app *application) purgeLoginFailures(ctx context.Context) {
+	ticker := time.NewTicker(loginFailurePurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := app.models.LoginFailures.DeleteStale(time.Now().Add(-app.config.login.failureWindow))
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		} else if n > 0 {
+			app.logger.PrintInfo("stale login failures deleted", map[string]string{
+				"count": strconv.Itoa(n),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
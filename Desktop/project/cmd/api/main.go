@@ -3,11 +3,19 @@ package main
 import (
 	"context"
 	"database/sql"
+	"expvar"
 	"flag"
+	"fmt"
 	_ "github.com/lib/pq"
 	"os"
 	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/filter"
+	"series.bekarysrymkhanov.net/internal/jobs"
 	"series.bekarysrymkhanov.net/internal/jsonlog"
+	"series.bekarysrymkhanov.net/internal/jwt"
+	"series.bekarysrymkhanov.net/internal/mailer"
+	"series.bekarysrymkhanov.net/internal/permcache"
+	"strings"
 	"time"
 )
 
@@ -27,11 +35,81 @@ type config struct {
 		burst   int
 		enabled bool
 	}
+	filter struct {
+		wordList        string
+		wordListAction  string
+		maxLinks        int
+		linksAction     string
+		floodWindow     time.Duration
+		floodMax        int
+		duplicateAction string
+		floodAction     string
+	}
+	reactions []string
+	comments  struct {
+		editWindow time.Duration
+		maxLength  int
+	}
+	mailer struct {
+		driver string
+		outbox string
+	}
+	auth struct {
+		accessTTL     time.Duration
+		refreshTTL    time.Duration
+		mode          string
+		jwtKeys       []string
+		jwtSigningKey string
+		jwtIssuer     string
+		// jwtDenylistNotify shares revocations of signed tokens, which are
+		// otherwise only known to the instance that made them.
+		jwtDenylistNotify bool
+		// clientTokenTTL is the lifetime of tokens issued to OAuth clients.
+		clientTokenTTL time.Duration
+	}
+	twoFactor struct {
+		requiredFor []string
+	}
+	permissions struct {
+		cacheTTL time.Duration
+		notify   bool
+	}
+	login struct {
+		backoffAfter    int
+		backoffBase     time.Duration
+		lockoutAfter    int
+		lockoutDuration time.Duration
+		failureWindow   time.Duration
+	}
+	accounts struct {
+		deletionGrace time.Duration
+	}
+	jobs struct {
+		workers      int
+		queueSize    int
+		drainTimeout time.Duration
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+		attempts int
+		backoff  time.Duration
+	}
 }
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
+	config        config
+	logger        *jsonlog.Logger
+	models        data.Models
+	contentFilter filter.ContentFilter
+	editFilter    filter.ContentFilter
+	mailer        mailer.Mailer
+	jobs          *jobs.Runner
+	keyring       *jwt.Keyring
+	denylist      *jwt.Denylist
+	permissions   *permcache.Cache
 }
 
 func main() {
@@ -46,8 +124,61 @@ func main() {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.StringVar(&cfg.filter.wordList, "filter-wordlist", "", "Path to the comment word list (one word per line, reloaded on change)")
+	flag.StringVar(&cfg.filter.wordListAction, "filter-wordlist-action", "mask", "Action for word list matches (mask|flag|reject)")
+	flag.IntVar(&cfg.filter.maxLinks, "filter-max-links", 2, "Maximum number of links in a comment")
+	flag.StringVar(&cfg.filter.linksAction, "filter-links-action", "flag", "Action for comments over the link limit (mask|flag|reject)")
+	flag.DurationVar(&cfg.filter.floodWindow, "filter-flood-window", time.Minute, "Window for duplicate and flood detection")
+	flag.IntVar(&cfg.filter.floodMax, "filter-flood-max", 5, "Maximum comments per user within the flood window")
+	flag.StringVar(&cfg.filter.duplicateAction, "filter-duplicate-action", "reject", "Action for repeated comments (allow|flag|reject)")
+	flag.StringVar(&cfg.filter.floodAction, "filter-flood-action", "flag", "Action for users over the flood limit (allow|flag|reject)")
+	flag.IntVar(&cfg.comments.maxLength, "comment-max-length", 1000, "Maximum rendered length of a comment in characters")
+	flag.DurationVar(&cfg.comments.editWindow, "comment-edit-window", 15*time.Minute, "How long after posting authors may edit a comment")
+	flag.DurationVar(&cfg.auth.accessTTL, "auth-access-ttl", 15*time.Minute, "Lifetime of authentication tokens")
+	flag.DurationVar(&cfg.auth.refreshTTL, "auth-refresh-ttl", 30*24*time.Hour, "Lifetime of refresh tokens")
+	flag.DurationVar(&cfg.auth.clientTokenTTL, "oauth-token-ttl", time.Hour, "Lifetime of tokens issued to OAuth clients")
+	flag.StringVar(&cfg.auth.mode, "auth-token-mode", tokenModeOpaque, "Kind of authentication token issued (opaque|jwt)")
+	flag.Func("jwt-key", "Key for signed tokens as kid:alg:base64 (HS256 secret, EdDSA seed or pub=EdDSA public key); may be repeated", func(val string) error {
+		cfg.auth.jwtKeys = append(cfg.auth.jwtKeys, val)
+		return nil
+	})
+	flag.StringVar(&cfg.auth.jwtSigningKey, "jwt-signing-key", "", "Key ID new signed tokens are signed with")
+	flag.StringVar(&cfg.auth.jwtIssuer, "jwt-issuer", "series.bekarysrymkhanov.net", "Issuer of signed tokens")
+	flag.BoolVar(&cfg.auth.jwtDenylistNotify, "jwt-denylist-notify", false, "Share revocations of signed tokens across instances with PostgreSQL LISTEN/NOTIFY (without it, each instance only knows its own)")
+	flag.Func("2fa-required-for", "Comma-separated permissions (e.g. episodes:write or episodes:*) whose routes require two-factor authentication", func(val string) error {
+		cfg.twoFactor.requiredFor = strings.Split(val, ",")
+		return nil
+	})
+	flag.DurationVar(&cfg.permissions.cacheTTL, "permissions-cache-ttl", time.Minute, "How long user permissions are cached (0 disables the cache)")
+	flag.BoolVar(&cfg.permissions.notify, "permissions-cache-notify", false, "Invalidate cached permissions across instances with PostgreSQL LISTEN/NOTIFY")
+	flag.IntVar(&cfg.login.backoffAfter, "login-backoff-after", 3, "Failed logins for an account before further attempts are delayed")
+	flag.DurationVar(&cfg.login.backoffBase, "login-backoff-base", time.Second, "Delay after the first delayed failure, doubled after each further one")
+	flag.IntVar(&cfg.login.lockoutAfter, "login-lockout-after", 10, "Failed logins for an account before it is locked")
+	flag.DurationVar(&cfg.login.lockoutDuration, "login-lockout-duration", 30*time.Minute, "How long a locked account stays locked unless unlocked by email or an admin")
+	flag.DurationVar(&cfg.login.failureWindow, "login-failure-window", time.Hour, "How long failed logins are remembered; the count starts over after this long without one")
+	flag.DurationVar(&cfg.accounts.deletionGrace, "account-deletion-grace", 30*24*time.Hour, "How long deleted accounts can be restored before they are anonymized")
+	flag.IntVar(&cfg.jobs.workers, "jobs-workers", 4, "Number of background job workers")
+	flag.IntVar(&cfg.jobs.queueSize, "jobs-queue-size", 256, "Maximum number of queued background jobs")
+	flag.DurationVar(&cfg.jobs.drainTimeout, "jobs-drain-timeout", 30*time.Second, "How long shutdown waits for queued background jobs")
+	flag.StringVar(&cfg.mailer.driver, "mailer", "outbox", "Mail driver (smtp|outbox)")
+	flag.StringVar(&cfg.mailer.outbox, "mailer-outbox", "outbox", "Directory the outbox mail driver writes emails to")
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Series <no-reply@series.bekarysrymkhanov.net>", "SMTP sender")
+	flag.IntVar(&cfg.smtp.attempts, "smtp-attempts", 3, "SMTP delivery attempts per email")
+	flag.DurationVar(&cfg.smtp.backoff, "smtp-backoff", 500*time.Millisecond, "Wait before the first SMTP retry, doubled after each attempt")
+	flag.Func("reactions", "Comma-separated set of allowed reaction emoji", func(val string) error {
+		cfg.reactions = strings.Split(val, ",")
+		return nil
+	})
 	flag.Parse()
 
+	if cfg.reactions == nil {
+		cfg.reactions = []string{"👍", "👎", "❤️", "😂", "😮", "😢", "😡"}
+	}
+
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 	db, err := openDB(cfg)
 	if err != nil {
@@ -61,12 +192,49 @@ func main() {
 	}(db)
 	logger.PrintInfo("database connection pool established", nil)
 
+	contentFilter, editFilter, err := newContentFilter(cfg, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	keyring, err := newKeyring(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	m, err := newMailer(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	models := data.NewModels(db)
+
 	app := application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
+		config:        cfg,
+		logger:        logger,
+		models:        models,
+		contentFilter: contentFilter,
+		editFilter:    editFilter,
+		mailer:        m,
+		jobs:          jobs.New(logger, cfg.jobs.workers, cfg.jobs.queueSize),
+		keyring:       keyring,
+		denylist:      jwt.NewDenylist(cfg.auth.accessTTL),
+		permissions:   permcache.New(cfg.permissions.cacheTTL, models.Permissions.GetAllForUser),
+	}
+
+	if cfg.auth.jwtDenylistNotify {
+		app.denylist.OnRevoke(func(key string, revokedAt int64) {
+			err := jwt.NotifyRevoked(db, key, revokedAt)
+			if err != nil {
+				logger.PrintError(err, nil)
+			}
+		})
 	}
 
+	expvar.Publish("permissions_cache", expvar.Func(func() any {
+		return app.permissions.Stats()
+	}))
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -74,6 +242,17 @@ func main() {
 
 }
 
+func newMailer(cfg config) (mailer.Mailer, error) {
+	switch cfg.mailer.driver {
+	case "smtp":
+		return mailer.NewSMTP(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender, cfg.smtp.attempts, cfg.smtp.backoff), nil
+	case "outbox":
+		return mailer.NewOutbox(cfg.mailer.outbox, cfg.smtp.sender)
+	default:
+		return nil, fmt.Errorf("invalid mailer driver %q", cfg.mailer.driver)
+	}
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
@@ -7,6 +7,8 @@ import (
 	"net"
 	"net/http"
 	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/jwt"
+	"series.bekarysrymkhanov.net/internal/permcache"
 	"series.bekarysrymkhanov.net/internal/validator"
 	"strings"
 	"sync"
@@ -90,12 +92,37 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		headerParts := strings.Split(authorizationHeader, " ")
+		// OAuth clients may send their credentials this way to the token
+		// endpoint, which checks them itself.
+		if len(headerParts) == 2 && headerParts[0] == "Basic" && r.URL.Path == oauthTokenPath {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(headerParts) == 2 && headerParts[0] == "ApiKey" {
+			app.authenticateAPIKey(w, r, next, headerParts[1])
+			return
+		}
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 		token := headerParts[1]
 
+		if app.keyring != nil && jwt.LooksLikeJWT(token) {
+			user, claims, err := app.verifyAccessToken(token)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetToken(r, token)
+			r = app.contextSetClaims(r, claims)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		v := validator.New()
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
 			app.invalidAuthenticationTokenResponse(w, r)
@@ -113,51 +140,163 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Service accounts only get authentication tokens from their
+		// OAuth clients, limited to the scopes granted with them.
+		if user.ServiceAccount {
+			scopes, err := app.models.Tokens.GetPermissions(token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			r = app.contextSetScopes(r, scopes)
+		}
+
+		err = app.models.Sessions.Touch(token)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 		next.ServeHTTP(w, r)
 	})
 }
 
+// authenticateAPIKey serves the request as the service account owning the
+// API key, provided the key is valid and allowed from the client's address.
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, plaintext string) {
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, plaintext); !v.Valid() {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
 
-func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-	user := app.contextGetUser(r)
-	if user.IsAnonymous() {
-		app.authenticationRequiredResponse(w, r)
+	key, user, err := app.models.APIKeys.GetForPlaintext(plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
+	}
+	if !key.AllowsIP(app.clientIP(r)) {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetAPIKey(r, key)
+	next.ServeHTTP(w, r)
+}
+
+// requestPermissions returns the permissions the request may use: those
+// embedded in a signed token, those of an API key or the scopes of an OAuth
+// access token that its owner still holds, or otherwise all of the user's.
+func (app *application) requestPermissions(r *http.Request) (data.Permissions, error) {
+	if claims := app.contextGetClaims(r); claims != nil {
+		return claims.Permissions, nil
+	}
+
+	permissions, err := app.permissions.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if key := app.contextGetAPIKey(r); key != nil {
+		return permissions.Intersect(key.Permissions), nil
+	}
+	if scopes := app.contextGetScopes(r); scopes != nil {
+		return permissions.Intersect(scopes), nil
+	}
+	return permissions, nil
+}
+
+// invalidatePermissions drops the cached permissions of the user, or of every
+// user when userID is zero, on this instance and, with LISTEN/NOTIFY enabled,
+// on all the others.
+func (app *application) invalidatePermissions(userID int64) {
+	if userID == 0 {
+		app.permissions.InvalidateAll()
+	} else {
+		app.permissions.Invalidate(userID)
+	}
+
+	if app.config.permissions.notify {
+		err := permcache.Notify(app.models.Permissions.DB, userID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
 		}
-			next.ServeHTTP(w, r)
-		})
+	}
+}
+
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
 		}
-	
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-	user := app.contextGetUser(r)
-		
-	if !user.Activated {
-		app.inactiveAccountResponse(w, r)
-		return
+		user := app.contextGetUser(r)
+
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
 		}
-		next.ServeHTTP(w, r)
-		})
-		return app.requireAuthenticatedUser(fn)
+		if user.Banned {
+			app.bannedAccountResponse(w, r)
+			return
 		}
+		next.ServeHTTP(w, r)
+	})
+	return app.requireAuthenticatedUser(fn)
+}
 
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-	user := app.contextGetUser(r)
-	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.requestPermissions(r)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
-				return
-			}
+			return
+		}
 		if !permissions.Include(code) {
 			app.notPermittedResponse(w, r)
-				return
-			}
-			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Service accounts cannot use two-factor authentication; their API
+		// keys and OAuth clients are restricted by permissions, scopes and
+		// addresses instead.
+		if app.requiresTwoFactor(code) && !app.contextGetUser(r).ServiceAccount {
+			var enabled bool
+			if claims := app.contextGetClaims(r); claims != nil {
+				enabled = claims.TwoFactor
+			} else {
+				enabled, err = app.models.TOTP.Enabled(app.contextGetUser(r).ID)
+				if err != nil {
+					app.serverErrorResponse(w, r, err)
+					return
+				}
 			}
-		
-			return app.requireActivatedUser(fn)
+			if !enabled {
+				app.twoFactorRequiredResponse(w, r)
+				return
 			}
-		
\ No newline at end of file
+		}
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
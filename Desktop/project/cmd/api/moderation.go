@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/validator"
+)
+
+func (app *application) reportCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	likeComment, err := app.models.LikeComment.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if likeComment.Status == data.CommentStatusHidden {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	report := &data.CommentReport{
+		CommentID: id,
+		UserID:    app.contextGetUser(r).ID,
+		Reason:    input.Reason,
+	}
+
+	v := validator.New()
+	if data.ValidateReport(v, report); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Moderation.InsertReport(report)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReport):
+			v.AddError("comment_id", "you have already reported this comment")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-report_count")
+	input.Filters.SortSafelist = []string{"id", "report_count", "created_at", "-id", "-report_count", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Moderation.Queue(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"queue": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) moderateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Action string `json:"action"`
+		Reason string `json:"reason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	likeComment, err := app.models.LikeComment.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	moderator := app.contextGetUser(r)
+	action := &data.ModerationAction{
+		ModeratorID: moderator.ID,
+		CommentID:   id,
+		AuthorID:    likeComment.UserID,
+		Action:      input.Action,
+		Reason:      input.Reason,
+	}
+
+	v := validator.New()
+	if data.ValidateModerationAction(v, action); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	switch action.Action {
+	case data.ModerationActionApprove:
+		err = app.models.Moderation.SetCommentStatus(id, data.CommentStatusVisible)
+		if err == nil {
+			err = app.models.Moderation.DeleteReportsForComment(id)
+		}
+	case data.ModerationActionHide:
+		err = app.models.Moderation.SetCommentStatus(id, data.CommentStatusHidden)
+	case data.ModerationActionDelete:
+		err = app.models.LikeComment.Delete(id)
+	case data.ModerationActionBan:
+		err = app.banUser(likeComment.UserID)
+		if err == nil {
+			err = app.models.Moderation.SetCommentStatus(id, data.CommentStatusHidden)
+		}
+	case data.ModerationActionPin:
+		err = app.models.Moderation.SetCommentPinned(id, true)
+	case data.ModerationActionUnpin:
+		err = app.models.Moderation.SetCommentPinned(id, false)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Moderation.LogAction(action)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.logger.PrintInfo("comment moderated", map[string]string{
+		"action":       action.Action,
+		"comment_id":   fmt.Sprint(action.CommentID),
+		"author_id":    fmt.Sprint(action.AuthorID),
+		"moderator_id": fmt.Sprint(action.ModeratorID),
+		"reason":       action.Reason,
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"moderation": action}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) banUser(userID int64) error {
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		return err
+	}
+	if user.Banned {
+		return nil
+	}
+	user.Banned = true
+	err = app.models.Users.Update(user)
+	if err != nil {
+		return err
+	}
+	app.denylist.RevokeSubject(user.ID)
+	app.invalidatePermissions(user.ID)
+	return nil
+}
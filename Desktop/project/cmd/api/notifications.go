@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/validator"
+)
+
+// notifyForComment notifies users mentioned in a new comment, the author of
+// the comment it replies to, and users who favorited its episode. Each user
+// gets at most one notification per comment; a reply outranks a mention,
+// which outranks a favorite. A popular episode has any number of favorites,
+// so the whole fan-out runs as one background task, and failures are logged
+// rather than returned so that they never fail the comment itself.
+func (app *application) notifyForComment(likeComment *data.LikeComment, parent *data.LikeComment) {
+	app.background("comment notifications", func() {
+		var recipients []int64
+		var types []string
+		if parent != nil {
+			recipients = append(recipients, parent.UserID)
+			types = append(types, data.NotificationReply)
+		}
+
+		if names := data.ParseMentions(likeComment.CommentText); len(names) > 0 {
+			users, err := app.models.Users.GetForMentions(names)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+			for _, user := range users {
+				recipients = append(recipients, user.ID)
+				types = append(types, data.NotificationMention)
+			}
+		}
+
+		notifications, err := app.models.Notifications.InsertForComment(likeComment.UserID, int64(likeComment.LikeID), int64(likeComment.EpisodeID), recipients, types)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"comment_id": fmt.Sprint(likeComment.LikeID),
+			})
+			return
+		}
+		for _, notification := range notifications {
+			app.emailNotification(notification)
+		}
+	})
+}
+
+// emailNotification emails a stored notification to its recipient.
+func (app *application) emailNotification(notification *data.Notification) {
+	user, err := app.models.Users.Get(notification.UserID)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"user_id": fmt.Sprint(notification.UserID)})
+		return
+	}
+
+	err = app.mailer.Send(user.Email, "notification.tmpl", map[string]any{
+		"name":      user.Name,
+		"type":      notification.Type,
+		"commentID": notification.CommentID,
+		"episodeID": notification.EpisodeID,
+	})
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"user_id": fmt.Sprint(notification.UserID)})
+	}
+}
+
+func (app *application) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Unread bool
+		data.Filters
+	}
+	v := validator.New()
+
+	qs := r.URL.Query()
+	input.Unread = app.readString(qs, "unread", "false") == "true"
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	notifications, metadata, err := app.models.Notifications.GetAllForUser(user.ID, input.Unread, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	unread, err := app.models.Notifications.UnreadCount(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"notifications": notifications, "unread_count": unread, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) markNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Notifications.MarkRead(user.ID, input.IDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	unread, err := app.models.Notifications.UnreadCount(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"unread_count": unread}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	preferences, err := app.models.Notifications.GetPreferences(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"muted": preferences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Muted map[string]bool `json:"muted"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateNotificationPreferences(v, input.Muted); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	for notificationType, muted := range input.Muted {
+		err = app.models.Notifications.SetPreference(user.ID, notificationType, muted)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	preferences, err := app.models.Notifications.GetPreferences(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"muted": preferences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/validator"
+	"strconv"
+)
+
+// oauthTokenPath is the OAuth 2.0 token endpoint. Clients may authenticate
+// to it with HTTP Basic credentials, which authenticate lets through there.
+const oauthTokenPath = "/oauth/token"
+
+// OAuth 2.0 error codes, as defined by RFC 6749 section 5.2.
+const (
+	oauthInvalidRequest       = "invalid_request"
+	oauthInvalidClient        = "invalid_client"
+	oauthUnauthorizedClient   = "unauthorized_client"
+	oauthUnsupportedGrantType = "unsupported_grant_type"
+	oauthInvalidScope         = "invalid_scope"
+)
+
+// oauthTokenHandler implements the client credentials grant of RFC 6749
+// section 4.4. The access token issued is an ordinary authentication token
+// of the client's service account, limited to the scopes granted.
+func (app *application) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, oauthInvalidRequest, "the request body must be application/x-www-form-urlencoded")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+	err := r.ParseForm()
+	if err != nil {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, oauthInvalidRequest, "the request body could not be parsed")
+		return
+	}
+	for name, values := range r.PostForm {
+		if len(values) > 1 {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, oauthInvalidRequest, "the "+name+" parameter must not be repeated")
+			return
+		}
+	}
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "client_credentials":
+	case "":
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, oauthInvalidRequest, "the grant_type parameter must be provided")
+		return
+	default:
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, oauthUnsupportedGrantType, "only the client_credentials grant is supported")
+		return
+	}
+
+	clientID, secret, basic, ok := app.readClientCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	client, user, err := app.models.OAuthClients.GetForCredentials(clientID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidClientResponse(w, r, basic)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !user.ServiceAccount || !user.Activated || user.Banned {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, oauthUnauthorizedClient, "the service account of this client is disabled")
+		return
+	}
+
+	// Without a scope parameter the client gets every scope it is allowed.
+	scopes := data.ParseScope(r.PostForm.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, code := range scopes {
+		if !client.Scopes.Include(code) {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, oauthInvalidScope, "the client is not allowed the scope "+code)
+			return
+		}
+	}
+
+	ttl := app.config.auth.clientTokenTTL
+	token, err := app.models.Tokens.NewForClient(client, ttl, scopes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.PrintInfo("oauth token issued", map[string]string{
+		"client_id": client.ClientID,
+		"user_id":   strconv.FormatInt(user.ID, 10),
+		"scope":     data.FormatScope(scopes),
+		"ip":        app.clientIP(r),
+	})
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+	headers.Set("Pragma", "no-cache")
+
+	env := envelope{
+		"access_token": token.Plaintext,
+		"token_type":   "Bearer",
+		"expires_in":   int(ttl.Seconds()),
+		"scope":        data.FormatScope(scopes),
+	}
+	err = app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readClientCredentials reads the client ID and secret from HTTP Basic
+// credentials or, failing that, from the request body, responding and
+// returning false when neither or both are used. basic reports which one it
+// was, as a failed Basic authentication must be challenged.
+func (app *application) readClientCredentials(w http.ResponseWriter, r *http.Request) (clientID, secret string, basic, ok bool) {
+	clientID, secret, basic = r.BasicAuth()
+	_, inBody := r.PostForm["client_id"]
+	if basic && inBody {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, oauthInvalidRequest, "the client must authenticate with a single method")
+		return "", "", basic, false
+	}
+
+	if !basic {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		if clientID == "" {
+			app.invalidClientResponse(w, r, false)
+			return "", "", false, false
+		}
+		return clientID, secret, false, true
+	}
+
+	// Basic credentials are form-encoded before being base64-encoded, as
+	// required by RFC 6749 section 2.3.1.
+	clientID, errID := url.QueryUnescape(clientID)
+	secret, errSecret := url.QueryUnescape(secret)
+	if errID != nil || errSecret != nil {
+		app.invalidClientResponse(w, r, true)
+		return "", "", true, false
+	}
+	return clientID, secret, true, true
+}
+
+func (app *application) invalidClientResponse(w http.ResponseWriter, r *http.Request, basic bool) {
+	if basic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	app.oauthErrorResponse(w, r, http.StatusUnauthorized, oauthInvalidClient, "invalid client credentials")
+}
+
+func (app *application) listOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readServiceAccount(w, r)
+	if !ok {
+		return
+	}
+
+	clients, err := app.models.OAuthClients.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"oauth_clients": clients}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createOAuthClientHandler registers an OAuth client for a service account.
+// The response is the only time the client secret is shown.
+func (app *application) createOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readServiceAccount(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ownerPermissions, err := app.permissions.Get(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	client := &data.OAuthClient{
+		UserID: user.ID,
+		Name:   input.Name,
+	}
+	for _, code := range input.Scopes {
+		client.Scopes = append(client.Scopes, data.CanonicalPermission(code))
+	}
+
+	v := validator.New()
+	if data.ValidateOAuthClient(v, client, ownerPermissions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.OAuthClients.Insert(client)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateOAuthClientName):
+			v.AddError("name", "the service account already has a client with this name")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.audit(r, data.AuditActionCreateOAuthClient, user.ID, map[string]any{
+		"oauth_client_id": client.ID,
+		"name":            client.Name,
+		"client_id":       client.ClientID,
+		"scopes":          client.Scopes,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"oauth_client": client}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteOAuthClientHandler removes a client together with every token issued
+// to it.
+func (app *application) deleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	client, err := app.models.OAuthClients.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.audit(r, data.AuditActionDeleteOAuthClient, client.UserID, map[string]any{
+		"oauth_client_id": client.ID,
+		"name":            client.Name,
+		"client_id":       client.ClientID,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "oauth client successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/validator"
+)
+
+func (app *application) readEmojiParam(r *http.Request) string {
+	params := httprouter.ParamsFromContext(r.Context())
+	return params.ByName("emoji")
+}
+
+// attachCommentReactions fills in the reaction summary of every comment as
+// seen by the given user.
+func (app *application) attachCommentReactions(user *data.User, likes ...*data.LikeComment) error {
+	ids := make([]int64, len(likes))
+	for i, like := range likes {
+		ids[i] = int64(like.LikeID)
+	}
+
+	summaries, err := app.models.Reactions.Summaries(data.ReactionTargetComment, ids, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, like := range likes {
+		like.Reactions = summaries[int64(like.LikeID)]
+	}
+	return nil
+}
+
+func (app *application) setCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.commentReaction(w, r, true)
+}
+
+func (app *application) deleteCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.commentReaction(w, r, false)
+}
+
+func (app *application) commentReaction(w http.ResponseWriter, r *http.Request, add bool) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	emoji := app.readEmojiParam(r)
+	v := validator.New()
+	if data.ValidateReaction(v, emoji, app.config.reactions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	likeComment, err := app.models.LikeComment.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if likeComment.Status == data.CommentStatusHidden {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if add {
+		err = app.models.Reactions.Add(data.ReactionTargetComment, id, user.ID, emoji)
+	} else {
+		err = app.models.Reactions.Remove(data.ReactionTargetComment, id, user.ID, emoji)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	summary, err := app.models.Reactions.Summary(data.ReactionTargetComment, id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reactions": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) setEpisodeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.episodeReaction(w, r, true)
+}
+
+func (app *application) deleteEpisodeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.episodeReaction(w, r, false)
+}
+
+func (app *application) episodeReaction(w http.ResponseWriter, r *http.Request, add bool) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	emoji := app.readEmojiParam(r)
+	v := validator.New()
+	if data.ValidateReaction(v, emoji, app.config.reactions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if add {
+		err = app.models.Reactions.Add(data.ReactionTargetEpisode, id, user.ID, emoji)
+	} else {
+		err = app.models.Reactions.Remove(data.ReactionTargetEpisode, id, user.ID, emoji)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	summary, err := app.models.Reactions.Summary(data.ReactionTargetEpisode, id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reactions": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
@@ -11,11 +12,6 @@ func (app *application) routes() http.Handler {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
-	//router.HandlerFunc(http.MethodGet, "/Episodes", app.requirePermission("movies:read", app.listEpisodesHandler))
-	//router.HandlerFunc(http.MethodPost, "/Episodes", app.requirePermission("movies:write", app.createEpisodeHandler))
-	//router.HandlerFunc(http.MethodGet, "/Episodes/:id", app.requirePermission("movies:read", app.showEpisodeHandler))
-	//router.HandlerFunc(http.MethodPatch, "/Episodes/:id", app.requirePermission("movies:write", app.updateEpisodeHandler))
-	//router.HandlerFunc(http.MethodDelete, "/Episodes/:id", app.requirePermission("movies:write", app.deleteEpisodeHandler))
 	//router.HandlerFunc(http.MethodGet, "/Episodes/:id/Characters", app.requirePermission("movies:write", app.showCharactersByEpisodesHandler))
 	//router.HandlerFunc(http.MethodGet, "/Episodes/:id/Like", app.requirePermission("movies:write", app.listLikeByEpisodeIdHandler))
 	//
@@ -32,11 +28,86 @@ func (app *application) routes() http.Handler {
 	//router.HandlerFunc(http.MethodDelete, "/Like/:id", app.requirePermission("movies:write", app.deleteLikeCommentHandler))
 	//
 	//router.HandlerFunc(http.MethodGet, "/healthcheck", app.healthcheckHandler)
-	//router.HandlerFunc(http.MethodPost, "/users", app.registerUserHandler)
-	//router.HandlerFunc(http.MethodPut, "/users/activated", app.activateUserHandler)
-	//router.HandlerFunc(http.MethodPost, "/tokens/authentication", app.createAuthenticationTokenHandler)
 
-	router.HandlerFunc(http.MethodGet, "/token", app.TokenGeneratorHandler)
+	router.HandlerFunc(http.MethodGet, "/episodes", app.requirePermission("episodes:read", app.listEpisodesHandler))
+	router.HandlerFunc(http.MethodPost, "/episodes", app.requirePermission("episodes:write", app.createEpisodeHandler))
+	router.HandlerFunc(http.MethodGet, "/episodes/:id", app.requirePermission("episodes:read", app.showEpisodeHandler))
+	router.HandlerFunc(http.MethodPatch, "/episodes/:id", app.requirePermission("episodes:write", app.updateEpisodeHandler))
+	router.HandlerFunc(http.MethodDelete, "/episodes/:id", app.requirePermission("episodes:write", app.deleteEpisodeHandler))
+	router.HandlerFunc(http.MethodPut, "/episodes/:id/reactions/:emoji", app.requireActivatedUser(app.setEpisodeReactionHandler))
+	router.HandlerFunc(http.MethodDelete, "/episodes/:id/reactions/:emoji", app.requireActivatedUser(app.deleteEpisodeReactionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/comments", app.listLikeHandler)
+	router.HandlerFunc(http.MethodPost, "/comments", app.requireActivatedUser(app.createLikeCommentHandler))
+	router.HandlerFunc(http.MethodGet, "/comments/:id", app.showLikeHandler)
+	router.HandlerFunc(http.MethodPatch, "/comments/:id", app.requireActivatedUser(app.updateLikeCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/comments/:id", app.requireActivatedUser(app.deleteLikeCommentHandler))
+	router.HandlerFunc(http.MethodGet, "/comments/:id/history", app.requireActivatedUser(app.showCommentHistoryHandler))
+	router.HandlerFunc(http.MethodPost, "/comments/:id/reports", app.requireActivatedUser(app.reportCommentHandler))
+	router.HandlerFunc(http.MethodPut, "/comments/:id/reactions/:emoji", app.requireActivatedUser(app.setCommentReactionHandler))
+	router.HandlerFunc(http.MethodDelete, "/comments/:id/reactions/:emoji", app.requireActivatedUser(app.deleteCommentReactionHandler))
+	router.HandlerFunc(http.MethodPut, "/comments/:id/vote", app.requireActivatedUser(app.voteCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/comments/:id/vote", app.requireActivatedUser(app.deleteCommentVoteHandler))
+	router.HandlerFunc(http.MethodGet, "/episodes/:id/comments", app.listLikeByEpisodeIdHandler)
+
+	router.HandlerFunc(http.MethodGet, "/moderation/comments", app.requirePermission("comments:moderate", app.listModerationQueueHandler))
+	router.HandlerFunc(http.MethodPost, "/moderation/comments/:id", app.requirePermission("comments:moderate", app.moderateCommentHandler))
+
+	router.HandlerFunc(http.MethodGet, "/users/me", app.requireAuthenticatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/users/me", app.requireAuthenticatedUser(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/users/me", app.requireAuthenticatedUser(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodGet, "/users/me/export", app.requireAuthenticatedUser(app.exportCurrentUserHandler))
+	router.HandlerFunc(http.MethodPut, "/users/me/password", app.requireAuthenticatedUser(app.changeCurrentUserPasswordHandler))
+	router.HandlerFunc(http.MethodPut, "/users/me/email", app.requireAuthenticatedUser(app.changeCurrentUserEmailHandler))
+	router.HandlerFunc(http.MethodGet, "/users/me/watched", app.requireActivatedUser(app.listWatchedEpisodesHandler))
+	router.HandlerFunc(http.MethodPut, "/users/me/watched/:id", app.requireActivatedUser(app.markEpisodeWatchedHandler))
+	router.HandlerFunc(http.MethodDelete, "/users/me/watched/:id", app.requireActivatedUser(app.unmarkEpisodeWatchedHandler))
+	router.HandlerFunc(http.MethodGet, "/users/me/favorites", app.requireActivatedUser(app.listFavoriteEpisodesHandler))
+	router.HandlerFunc(http.MethodPut, "/users/me/favorites/:id", app.requireActivatedUser(app.addFavoriteEpisodeHandler))
+	router.HandlerFunc(http.MethodDelete, "/users/me/favorites/:id", app.requireActivatedUser(app.removeFavoriteEpisodeHandler))
+	router.HandlerFunc(http.MethodPost, "/users/me/2fa", app.requireActivatedUser(app.enrollTwoFactorHandler))
+	router.HandlerFunc(http.MethodPost, "/users/me/2fa/confirm", app.requireActivatedUser(app.confirmTwoFactorHandler))
+	router.HandlerFunc(http.MethodDelete, "/users/me/2fa", app.requireActivatedUser(app.disableTwoFactorHandler))
+	router.HandlerFunc(http.MethodGet, "/users/me/sessions", app.requireAuthenticatedUser(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/users/me/sessions/:id", app.requireAuthenticatedUser(app.deleteSessionHandler))
+	router.HandlerFunc(http.MethodGet, "/users/me/notifications", app.requireActivatedUser(app.listNotificationsHandler))
+	router.HandlerFunc(http.MethodPost, "/users/me/notifications/read", app.requireActivatedUser(app.markNotificationsReadHandler))
+	router.HandlerFunc(http.MethodGet, "/users/me/notification-preferences", app.requireActivatedUser(app.showNotificationPreferencesHandler))
+	router.HandlerFunc(http.MethodPut, "/users/me/notification-preferences", app.requireActivatedUser(app.updateNotificationPreferencesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/admin/users", app.requirePermission("users:manage", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/admin/users/:id", app.requirePermission("users:manage", app.showUserHandler))
+	router.HandlerFunc(http.MethodPut, "/admin/users/:id/activated", app.requirePermission("users:manage", app.updateUserActivationHandler))
+	router.HandlerFunc(http.MethodPost, "/admin/users/:id/permissions", app.requirePermission("users:manage", app.grantPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/admin/users/:id/permissions", app.requirePermission("users:manage", app.revokePermissionsHandler))
+	router.HandlerFunc(http.MethodPost, "/admin/users/:id/roles", app.requirePermission("users:manage", app.assignRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/admin/users/:id/roles", app.requirePermission("users:manage", app.removeRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/admin/users/:id/unlock", app.requirePermission("users:manage", app.adminUnlockUserHandler))
+	router.HandlerFunc(http.MethodGet, "/admin/roles", app.requirePermission("users:manage", app.listRolesHandler))
+	router.HandlerFunc(http.MethodGet, "/admin/permissions", app.requirePermission("users:manage", app.listPermissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/admin/audit-log", app.requirePermission("users:manage", app.listAuditLogHandler))
+	router.HandlerFunc(http.MethodPost, "/admin/service-accounts", app.requirePermission("service-accounts:manage", app.createServiceAccountHandler))
+	router.HandlerFunc(http.MethodGet, "/admin/service-accounts/:id/keys", app.requirePermission("service-accounts:manage", app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/admin/service-accounts/:id/keys", app.requirePermission("service-accounts:manage", app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/admin/api-keys/:id", app.requirePermission("service-accounts:manage", app.deleteAPIKeyHandler))
+	router.HandlerFunc(http.MethodGet, "/admin/service-accounts/:id/oauth-clients", app.requirePermission("service-accounts:manage", app.listOAuthClientsHandler))
+	router.HandlerFunc(http.MethodPost, "/admin/service-accounts/:id/oauth-clients", app.requirePermission("service-accounts:manage", app.createOAuthClientHandler))
+	router.HandlerFunc(http.MethodDelete, "/admin/oauth-clients/:id", app.requirePermission("service-accounts:manage", app.deleteOAuthClientHandler))
+
+	router.HandlerFunc(http.MethodPost, "/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPut, "/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/users/unlocked", app.unlockUserHandler)
+	router.HandlerFunc(http.MethodPut, "/users/email", app.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodPost, "/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/tokens/authentication", app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/tokens/authentication/2fa", app.createTwoFactorAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/tokens/password-reset", app.createPasswordResetTokenHandler)
+
+	router.HandlerFunc(http.MethodPost, oauthTokenPath, app.oauthTokenHandler)
+
+	router.HandlerFunc(http.MethodGet, "/debug/vars", app.requirePermission("metrics:view", expvar.Handler().ServeHTTP))
 
 	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
 
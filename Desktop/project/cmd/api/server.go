@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"series.bekarysrymkhanov.net/internal/jwt"
+	"series.bekarysrymkhanov.net/internal/permcache"
 	"syscall"
 	"time"
 )
@@ -23,6 +25,27 @@ func (app *application) serve() error {
 	}
 	shutdownError := make(chan error)
 
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go app.purgeDeletedAccounts(backgroundCtx)
+	go app.purgeLoginFailures(backgroundCtx)
+	if app.config.permissions.notify {
+		go func() {
+			err := permcache.Listen(backgroundCtx, app.config.db.dsn, app.permissions, app.logger)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}()
+	}
+	if app.keyring != nil && app.config.auth.jwtDenylistNotify {
+		go func() {
+			err := jwt.ListenRevoked(backgroundCtx, app.config.db.dsn, app.denylist, app.logger)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}()
+	}
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -30,9 +53,21 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("caught signal", map[string]string{
 			"signal": s.String(),
 		})
+		stopBackground()
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		shutdownError <- srv.Shutdown(ctx)
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		app.logger.PrintInfo("draining background jobs", map[string]string{
+			"addr": srv.Addr,
+		})
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), app.config.jobs.drainTimeout)
+		defer drainCancel()
+		shutdownError <- app.jobs.Shutdown(drainCtx)
 	}()
 
 	app.logger.PrintInfo("starting server", map[string]string{
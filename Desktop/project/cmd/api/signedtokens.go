@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/jwt"
+)
+
+const (
+	tokenModeOpaque = "opaque"
+	tokenModeJWT    = "jwt"
+)
+
+// newKeyring loads the signing keys when the API issues signed access tokens.
+// It returns nil in opaque token mode.
+func newKeyring(cfg config) (*jwt.Keyring, error) {
+	switch cfg.auth.mode {
+	case tokenModeOpaque:
+		return nil, nil
+	case tokenModeJWT:
+	default:
+		return nil, fmt.Errorf("invalid token mode %q", cfg.auth.mode)
+	}
+
+	var keys []*jwt.Key
+	for _, spec := range cfg.auth.jwtKeys {
+		key, err := jwt.ParseKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return jwt.NewKeyring(cfg.auth.jwtIssuer, cfg.auth.jwtSigningKey, keys...)
+}
+
+// opaqueAccessTTL is the lifetime of the authentication tokens stored in the
+// database, which are not issued at all when access tokens are signed.
+func (app *application) opaqueAccessTTL() time.Duration {
+	if app.keyring != nil {
+		return 0
+	}
+	return app.config.auth.accessTTL
+}
+
+// issueAccessToken signs an access token for the user in the given session.
+// Permissions are embedded so that requests made with it need no lookups.
+func (app *application) issueAccessToken(user *data.User, sessionID int64) (*data.Token, error) {
+	permissions, err := app.permissions.Get(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := app.models.TOTP.Enabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	jti := make([]byte, 16)
+	_, err = rand.Read(jti)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	claims := &jwt.Claims{
+		Subject:     user.ID,
+		ID:          base64.RawURLEncoding.EncodeToString(jti),
+		SessionID:   sessionID,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(app.config.auth.accessTTL).Unix(),
+		Name:        user.Name,
+		Picture:     user.Avatar,
+		Activated:   user.Activated,
+		Banned:      user.Banned,
+		TwoFactor:   twoFactor,
+		Permissions: permissions,
+	}
+
+	signed, err := app.keyring.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &data.Token{
+		Plaintext: signed,
+		UserID:    user.ID,
+		Expiry:    time.Unix(claims.ExpiresAt, 0),
+		Scope:     data.ScopeAuthentication,
+		SessionID: sessionID,
+	}, nil
+}
+
+// verifyAccessToken checks a signed access token without touching the
+// database and returns the user it stands for.
+func (app *application) verifyAccessToken(token string) (*data.User, *jwt.Claims, error) {
+	claims, err := app.keyring.Verify(token, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if app.denylist.Revoked(claims) {
+		return nil, nil, jwt.ErrInvalidToken
+	}
+
+	user := &data.User{
+		ID:        claims.Subject,
+		Name:      claims.Name,
+		Avatar:    claims.Picture,
+		Activated: claims.Activated,
+		Banned:    claims.Banned,
+	}
+	return user, claims, nil
+}
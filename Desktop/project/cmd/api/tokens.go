@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"series.bekarysrymkhanov.net/internal/data"
 	"series.bekarysrymkhanov.net/internal/validator"
+	"strconv"
 	"time"
 )
 
@@ -27,11 +28,21 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	if app.loginLocked(w, r, input.Email) {
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(input.Email)
+	if err == nil && user.Anonymized {
+		err = data.ErrRecordNotFound
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.invalidCredentialsResponse(w, r)
+			// Spend as long as a wrong password would, so that response
+			// times don't reveal which emails are registered.
+			data.DummyPasswordCheck(input.Password)
+			app.loginFailed(w, r, input.Email, nil)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -44,18 +55,269 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	if !match {
-		app.invalidCredentialsResponse(w, r)
+	// Service accounts authenticate with API keys and OAuth clients only.
+	if !match || user.ServiceAccount {
+		app.loginFailed(w, r, input.Email, user)
+		return
+	}
+
+	enabled, err := app.models.TOTP.Enabled(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if enabled {
+		token, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.Scope2FAPending)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env := envelope{"2fa_pending_token": token, "message": "exchange this token and an authenticator code at POST /tokens/authentication/2fa"}
+		err = app.writeJSON(w, http.StatusAccepted, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.startSession(w, r, user)
+}
+
+// createTwoFactorAuthenticationTokenHandler completes a login of a user with
+// two-factor authentication: the 2fa-pending token and a valid authenticator
+// or recovery code are exchanged for the usual tokens.
+func (app *application) createTwoFactorAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		Code           string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	data.ValidateTOTPCode(v, input.Code)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.Scope2FAPending, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired two-factor token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Authenticator codes are far easier to guess than passwords, so
+	// failures count towards the same lockout.
+	if app.loginLocked(w, r, user.Email) {
+		return
+	}
+
+	ok, err := app.verifySecondFactor(user.ID, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.loginFailed(w, r, user.Email, user)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.Scope2FAPending, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.startSession(w, r, user)
+}
+
+// startSession responds with the authentication and refresh token of a new
+// session for the user.
+func (app *application) startSession(w http.ResponseWriter, r *http.Request, user *data.User) {
+	err := app.loginSucceeded(r, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Logging in to a deleted account within its grace period restores it.
+	if user.DeletedAt != nil {
+		err = app.models.Users.Restore(user)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.invalidatePermissions(user.ID)
+		app.logger.PrintInfo("account restored", map[string]string{
+			"user_id": strconv.FormatInt(user.ID, 10),
+		})
+	}
+
+	token, refreshToken, err := app.models.Tokens.NewSession(user.ID, r.UserAgent(), app.clientIP(r), app.opaqueAccessTTL(), app.config.auth.refreshTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if app.keyring != nil {
+		token, err = app.issueAccessToken(user, refreshToken.SessionID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token, "refresh_token": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshAuthenticationTokenHandler exchanges a refresh token for a new
+// authentication token and refresh token. The old refresh token stops working.
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, input.RefreshToken)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeAuthentication)
+	token, refreshToken, err := app.models.Tokens.Rotate(input.RefreshToken, r.UserAgent(), app.clientIP(r), app.opaqueAccessTTL(), app.config.auth.refreshTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			app.logger.PrintInfo("refresh token reused, session revoked", map[string]string{
+				"remote_addr": r.RemoteAddr,
+			})
+			app.invalidAuthenticationTokenResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.keyring != nil {
+		user, err := app.models.Users.Get(refreshToken.UserID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		token, err = app.issueAccessToken(user, refreshToken.SessionID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token, "refresh_token": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAuthenticationTokenHandler logs out the session of the token the
+// request was made with.
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	if claims := app.contextGetClaims(r); claims != nil {
+		// Signed tokens cannot be deleted, only denied until they expire.
+		app.denylist.RevokeToken(claims)
+		err = app.models.Sessions.Delete(claims.SessionID, claims.Subject)
+		if errors.Is(err, data.ErrRecordNotFound) {
+			err = nil
+		}
+	} else {
+		err = app.models.Tokens.Revoke(app.contextGetToken(r))
+	}
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createPasswordResetTokenHandler issues a password-reset token for the
+// account with the given email. The response is the same whether or not such
+// an account exists, so it cannot be used to probe for registered emails. The
+// account is looked up and the token created in the background, so that the
+// response takes as long either way.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.background("send password reset email", func() {
+		user, err := app.models.Users.GetByEmail(input.Email)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.PrintError(err, nil)
+			}
+			return
+		}
+
+		token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		data := map[string]any{
+			"name":               user.Name,
+			"passwordResetToken": token.Plaintext,
+		}
+
+		err = app.mailer.Send(user.Email, "password_reset.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	env := envelope{"message": "if an account with that email exists, you will receive password reset instructions"}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"series.bekarysrymkhanov.net/internal/data"
+	"series.bekarysrymkhanov.net/internal/totp"
+	"series.bekarysrymkhanov.net/internal/validator"
+	"time"
+)
+
+// totpIssuer names the API in authenticator apps.
+const totpIssuer = "Series"
+
+// verifySecondFactor accepts either a current authenticator code or an unused
+// recovery code of the user. Each code works only once.
+func (app *application) verifySecondFactor(userID int64, code string) (bool, error) {
+	t, err := app.models.TOTP.GetForUser(userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !t.Confirmed {
+		return false, nil
+	}
+
+	if counter, ok := totp.Validate(t.Secret, code, time.Now()); ok {
+		return app.models.TOTP.UseCounter(userID, counter)
+	}
+	return app.models.TOTP.UseRecoveryCode(userID, code)
+}
+
+// requiresTwoFactor reports whether routes guarded by the permission are only
+// open to users with two-factor authentication enabled.
+func (app *application) requiresTwoFactor(code string) bool {
+	return data.Permissions(app.config.twoFactor.requiredFor).Include(code)
+}
+
+// enrollTwoFactorHandler generates an authenticator secret for the user. It
+// protects nothing until confirmed with a code from the authenticator.
+func (app *application) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.TOTP.SetPending(user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.twoFactorAlreadyEnabledResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"secret": secret, "provisioning_uri": totp.URI(totpIssuer, user.Email, secret)}
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmTwoFactorHandler enables two-factor authentication once the user
+// shows a valid code, and returns the recovery codes. They are not shown again.
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	t, err := app.models.TOTP.GetForUser(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if t.Confirmed {
+		app.twoFactorAlreadyEnabledResponse(w, r)
+		return
+	}
+
+	counter, ok := totp.Validate(t.Secret, input.Code, time.Now())
+	if !ok {
+		v.AddError("code", "invalid authenticator code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	recoveryCodes, err := data.GenerateRecoveryCodes()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.TOTP.Confirm(user.ID, counter, recoveryCodes)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.twoFactorAlreadyEnabledResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": recoveryCodes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// disableTwoFactorHandler turns two-factor authentication off, which takes a
+// valid authenticator or recovery code.
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	ok, err := app.verifySecondFactor(user.ID, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		v.AddError("code", "invalid authenticator or recovery code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TOTP.Delete(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Signed tokens carry the two-factor state, so they must be reissued.
+	app.denylist.RevokeSubject(user.ID)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"series.bekarysrymkhanov.net/internal/data"
+)
+
+// redactSpoilers hides the text of spoiler comments from the user unless they
+// wrote the comment or have watched the episode it spoils. Anonymous users
+// never see spoilers.
+func (app *application) redactSpoilers(user *data.User, likes ...*data.LikeComment) error {
+	var episodeIDs []int64
+	for _, like := range likes {
+		if like.SpoilerEpisodeID != nil && !like.IsAuthor(user) {
+			episodeIDs = append(episodeIDs, *like.SpoilerEpisodeID)
+		}
+	}
+	if len(episodeIDs) == 0 {
+		return nil
+	}
+
+	watched := map[int64]bool{}
+	if !user.IsAnonymous() {
+		var err error
+		watched, err = app.models.Watched.WatchedAmong(user.ID, episodeIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, like := range likes {
+		if like.SpoilerEpisodeID != nil && !like.IsAuthor(user) && !watched[*like.SpoilerEpisodeID] {
+			like.Redact()
+		}
+	}
+	return nil
+}
+
+func (app *application) listWatchedEpisodesHandler(w http.ResponseWriter, r *http.Request) {
+	watched, err := app.models.Watched.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"watched": watched}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) markEpisodeWatchedHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Watched.Add(app.contextGetUser(r).ID, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "episode marked as watched"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unmarkEpisodeWatchedHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(w, r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Watched.Remove(app.contextGetUser(r).ID, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "episode no longer marked as watched"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
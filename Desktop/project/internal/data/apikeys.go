@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"series.bekarysrymkhanov.net/internal/validator"
+)
+
+var ErrDuplicateAPIKeyName = errors.New("duplicate api key name")
+
+// APIKey is a long-lived credential of a service account. Only its hash is
+// stored; the plaintext is shown once, when the key is created.
+type APIKey struct {
+	ID          int64       `json:"id"`
+	UserID      int64       `json:"user_id"`
+	Name        string      `json:"name"`
+	Plaintext   string      `json:"key,omitempty"`
+	Prefix      string      `json:"prefix"`
+	Hash        []byte      `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	AllowedIPs  []string    `json:"allowed_ips"`
+	Expiry      *time.Time  `json:"expiry"`
+	CreatedAt   time.Time   `json:"created_at"`
+	LastUsedAt  *time.Time  `json:"last_used_at"`
+}
+
+// apiKeyPrefixLength is how much of the plaintext is kept to tell keys apart.
+const apiKeyPrefixLength = 8
+
+// AllowsIP reports whether the key may be used from ip. Keys without allowed
+// networks may be used from anywhere.
+func (k *APIKey) AllowsIP(ip string) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range k.AllowedIPs {
+		prefix, err := parseAllowedIP(allowed)
+		if err == nil && prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAllowedIP accepts a single address or a CIDR network.
+func parseAllowedIP(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return addr.Prefix(addr.BitLen())
+}
+
+// ValidateAPIKey checks a new key against the permissions its owner holds.
+func ValidateAPIKey(v *validator.Validator, key *APIKey, ownerPermissions Permissions) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(key.Permissions) > 0, "permissions", "must contain at least one permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range key.Permissions {
+		v.Check(ownerPermissions.Include(code), "permissions", "must be a subset of the service account's permissions")
+	}
+	for _, allowed := range key.AllowedIPs {
+		_, err := parseAllowedIP(allowed)
+		v.Check(err == nil, "allowed_ips", "must contain IP addresses or CIDR networks")
+	}
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// Insert generates the key material and stores the key, leaving the
+// plaintext on key for the caller to show.
+func (m APIKeyModel) Insert(key *APIKey) error {
+	plaintext, err := randomPlaintext()
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(plaintext))
+	key.Plaintext = plaintext
+	key.Prefix = plaintext[:apiKeyPrefixLength]
+	key.Hash = hash[:]
+	if key.AllowedIPs == nil {
+		key.AllowedIPs = []string{}
+	}
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, hash, permissions, allowed_ips, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+	args := []interface{}{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array(key.Permissions), pq.Array(key.AllowedIPs), key.Expiry}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "api_keys_user_id_name_key"`:
+			return ErrDuplicateAPIKeyName
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, permissions, allowed_ips, expiry, created_at, last_used_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Permissions),
+			pq.Array(&key.AllowedIPs),
+			&key.Expiry,
+			&key.CreatedAt,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetForPlaintext returns an unexpired key together with its owner and
+// records that it was used. Keys of deleted users are not returned.
+func (m APIKeyModel) GetForPlaintext(plaintext string) (*APIKey, *User, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+	query := `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		FROM users
+		WHERE api_keys.hash = $1
+		AND (api_keys.expiry IS NULL OR api_keys.expiry > NOW())
+		AND users.id = api_keys.user_id
+		AND users.deleted_at IS NULL
+		RETURNING api_keys.id, api_keys.name, api_keys.prefix, api_keys.permissions, api_keys.allowed_ips,
+		api_keys.expiry, api_keys.created_at, api_keys.last_used_at,
+		users.id, users.created_at, users.name, COALESCE(users.username, ''), users.email, users.avatar, users.activated, users.banned,
+		users.service_account, users.version`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		key  APIKey
+		user User
+	)
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Permissions),
+		pq.Array(&key.AllowedIPs),
+		&key.Expiry,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Username,
+		&user.Email,
+		&user.Avatar,
+		&user.Activated,
+		&user.Banned,
+		&user.ServiceAccount,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	key.UserID = user.ID
+	return &key, &user, nil
+}
+
+// Delete revokes the key and returns it, without its secret, for the audit
+// log.
+func (m APIKeyModel) Delete(id int64) (*APIKey, error) {
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1
+		RETURNING user_id, name, prefix`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	key := APIKey{ID: id}
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&key.UserID, &key.Name, &key.Prefix)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &key, nil
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	AuditActionActivate             = "activate"
+	AuditActionDeactivate           = "deactivate"
+	AuditActionGrantPermissions     = "grant-permissions"
+	AuditActionRevokePermissions    = "revoke-permissions"
+	AuditActionUnlock               = "unlock"
+	AuditActionAssignRoles          = "assign-roles"
+	AuditActionRemoveRoles          = "remove-roles"
+	AuditActionCreateServiceAccount = "create-service-account"
+	AuditActionCreateAPIKey         = "create-api-key"
+	AuditActionRevokeAPIKey         = "revoke-api-key"
+	AuditActionCreateOAuthClient    = "create-oauth-client"
+	AuditActionDeleteOAuthClient    = "delete-oauth-client"
+)
+
+// AuditEntry records a change an administrator made to a user account.
+type AuditEntry struct {
+	ID           int64          `json:"id"`
+	ActorID      *int64         `json:"actor_id"`
+	TargetUserID *int64         `json:"target_user_id"`
+	Action       string         `json:"action"`
+	Details      map[string]any `json:"details"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+func (m AuditModel) Insert(entry *AuditEntry) error {
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO admin_audit_log (actor_id, target_user_id, action, details)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+	args := []interface{}{entry.ActorID, entry.TargetUserID, entry.Action, details}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// GetAll lists audit entries, newest first by default. A targetUserID of zero
+// lists the entries for every user.
+func (m AuditModel) GetAll(targetUserID int64, filters Filters) ([]*AuditEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, actor_id, target_user_id, action, details, created_at
+		FROM admin_audit_log
+		WHERE (target_user_id = $1 OR $1 = 0)
+		ORDER BY %s %s, id DESC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, targetUserID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		var (
+			entry   AuditEntry
+			details []byte
+		)
+		err := rows.Scan(&totalRecords, &entry.ID, &entry.ActorID, &entry.TargetUserID, &entry.Action, &details, &entry.CreatedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		if err := json.Unmarshal(details, &entry.Details); err != nil {
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	return entries, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
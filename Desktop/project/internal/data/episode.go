@@ -3,11 +3,13 @@ package data
 import "time"
 
 type Episode struct {
-	ID         int64     `json:"id"`
-	CreatedAt  time.Time `json:"-"`
-	Title      string    `json:"title"`
-	Year       int32     `json:"year,omitempty"`
-	Runtime    Runtime   `json:"runtime,omitempty"`
-	Characters []string  `json:"characters,omitempty"`
-	Version    int32     `json:"version"`
+	ID         int64            `json:"id"`
+	CreatedAt  time.Time        `json:"-"`
+	Title      string           `json:"title"`
+	Year       int32            `json:"year,omitempty"`
+	Runtime    Runtime          `json:"runtime,omitempty"`
+	Characters []string         `json:"characters,omitempty"`
+	Reactions  *ReactionSummary `json:"reactions,omitempty"`
+	Favorites  int              `json:"favorites"`
+	Version    int32            `json:"version"`
 }
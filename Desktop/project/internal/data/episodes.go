@@ -10,6 +10,9 @@ import (
 	"time"
 )
 
+// episodeFavoritesQuery counts the users who marked the episode e as favorite.
+const episodeFavoritesQuery = `(SELECT count(*) FROM favorite_episodes WHERE favorite_episodes.episode_id = e.id)`
+
 type EpisodeModel struct {
 	DB *sql.DB
 }
@@ -32,8 +35,8 @@ func (e EpisodeModel) Get(id int64) (*Episode, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT id, created_at, title, year, runtime, characters, version
-				FROM episodes
+	query := `SELECT id, created_at, title, year, runtime, characters, version, ` + episodeFavoritesQuery + `
+				FROM episodes e
 				WHERE id = $1`
 	var episode Episode
 
@@ -49,6 +52,7 @@ func (e EpisodeModel) Get(id int64) (*Episode, error) {
 		&episode.Runtime,
 		pq.Array(&episode.Characters),
 		&episode.Version,
+		&episode.Favorites,
 	)
 	if err != nil {
 		switch {
@@ -118,12 +122,12 @@ func (e EpisodeModel) Delete(id int64) error {
 
 func (e EpisodeModel) GetAll(title string, characters []string, filters Filters) ([]*Episode, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, year, runtime, characters, version
-		FROM episodes
+		SELECT count(*) OVER(), id, created_at, title, year, runtime, characters, version, %s AS favorites
+		FROM episodes e
 		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (characters @> $2 OR $2 = '{}')
 		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		LIMIT $3 OFFSET $4`, episodeFavoritesQuery, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -150,6 +154,7 @@ func (e EpisodeModel) GetAll(title string, characters []string, filters Filters)
 			&episode.Runtime,
 			pq.Array(&episode.Characters),
 			&episode.Version,
+			&episode.Favorites,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ExportSection is one part of a user's personal data export, as JSON.
+type ExportSection struct {
+	Name string
+	Data json.RawMessage
+}
+
+// exportQueries select everything stored about a user, section by section.
+// Each query takes the user ID as $1.
+var exportQueries = []struct {
+	name  string
+	query string
+}{
+	{"profile", `
+		SELECT id, created_at, name, email, pending_email, avatar, activated, banned, deleted_at
+		FROM users
+		WHERE id = $1`},
+	{"granted_permissions", `
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+		WHERE users_permissions.user_id = $1`},
+	{"roles", `
+		SELECT roles.name
+		FROM roles
+		INNER JOIN users_roles ON users_roles.role_id = roles.id
+		WHERE users_roles.user_id = $1`},
+	{"comments", `
+		SELECT id, episode_id, parent_id, spoiler_episode_id, comment_text, status, pinned, created_at, edited_at
+		FROM like_comment
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"comment_revisions", `
+		SELECT comment_id, comment_text, created_at
+		FROM comment_revisions
+		WHERE editor_id = $1
+		ORDER BY created_at`},
+	{"comment_votes", `
+		SELECT comment_id, value, created_at
+		FROM comment_votes
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"comment_reactions", `
+		SELECT comment_id, emoji, created_at
+		FROM comment_reactions
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"episode_reactions", `
+		SELECT episode_id, emoji, created_at
+		FROM episode_reactions
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"comment_reports", `
+		SELECT comment_id, reason, created_at
+		FROM comment_reports
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"favorites", `
+		SELECT episode_id, created_at
+		FROM favorite_episodes
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"watched", `
+		SELECT episode_id, watched_at
+		FROM watched_episodes
+		WHERE user_id = $1
+		ORDER BY watched_at`},
+	{"notifications", `
+		SELECT id, type, actor_id, comment_id, episode_id, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"notification_preferences", `
+		SELECT type, muted
+		FROM notification_preferences
+		WHERE user_id = $1`},
+	{"sessions", `
+		SELECT id, user_agent, ip, created_at, last_used_at
+		FROM sessions
+		WHERE user_id = $1
+		ORDER BY created_at`},
+}
+
+type ExportModel struct {
+	DB *sql.DB
+}
+
+// ForUser collects the personal data of the user.
+func (m ExportModel) ForUser(userID int64) ([]ExportSection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// One read-only transaction gives a consistent snapshot across sections.
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sections := make([]ExportSection, 0, len(exportQueries))
+	for _, q := range exportQueries {
+		query := `SELECT coalesce(json_agg(section), '[]') FROM (` + q.query + `) section`
+
+		var data []byte
+		err := tx.QueryRowContext(ctx, query, userID).Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, ExportSection{Name: q.name, Data: data})
+	}
+	return sections, tx.Commit()
+}
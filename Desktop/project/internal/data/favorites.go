@@ -0,0 +1,83 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type FavoriteModel struct {
+	DB *sql.DB
+}
+
+func (m FavoriteModel) Add(userID, episodeID int64) error {
+	query := `
+		INSERT INTO favorite_episodes (user_id, episode_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, episodeID)
+	return err
+}
+
+func (m FavoriteModel) Remove(userID, episodeID int64) error {
+	query := `
+		DELETE FROM favorite_episodes
+		WHERE user_id = $1 AND episode_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, episodeID)
+	return err
+}
+
+// GetAllForUser returns a page of the episodes the user marked as favorite.
+// Sorting by favorited_at orders them by when they were marked.
+func (m FavoriteModel) GetAllForUser(userID int64, filters Filters) ([]*Episode, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), e.id, e.created_at, e.title, e.year, e.runtime, e.characters, e.version, %s AS favorites
+		FROM (
+			SELECT episode_id, created_at AS favorited_at
+			FROM favorite_episodes
+			WHERE user_id = $1
+		) f
+		INNER JOIN episodes e ON e.id = f.episode_id
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, episodeFavoritesQuery, filters.sortColumn(), filters.sortDirection())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	episodes := []*Episode{}
+	for rows.Next() {
+		var episode Episode
+		err := rows.Scan(
+			&totalRecords,
+			&episode.ID,
+			&episode.CreatedAt,
+			&episode.Title,
+			&episode.Year,
+			&episode.Runtime,
+			pq.Array(&episode.Characters),
+			&episode.Version,
+			&episode.Favorites,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		episodes = append(episodes, &episode)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	return episodes, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
@@ -3,23 +3,80 @@ package data
 import (
 	"context"
 	"database/sql"
-	//"errors"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
+	"unicode/utf8"
 	//"github.com/lib/pq"
+	"series.bekarysrymkhanov.net/internal/markdown"
 	"series.bekarysrymkhanov.net/internal/validator"
 )
 
+type CommentAuthor struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Avatar string `json:"avatar"`
+}
+
 type LikeComment struct {
-	LikeID      int       `json:"id"`
-	UserID      int       `json:"user_id"`
-	EpisodeID   int       `json:"episode_id"`
+	LikeID           int              `json:"id"`
+	UserID           int64            `json:"-"`
+	Author           CommentAuthor    `json:"author"`
+	EpisodeID        int              `json:"episode_id"`
+	ParentID         *int64           `json:"parent_id"`
+	SpoilerEpisodeID *int64           `json:"spoiler_episode_id"`
+	Redacted         bool             `json:"redacted"`
+	CommentText      string           `json:"comment_text"`
+	LikeCount        int              `json:"like_count"`
+	Upvotes          int              `json:"upvotes"`
+	Downvotes        int              `json:"downvotes"`
+	Pinned           bool             `json:"pinned"`
+	ReactionCount    int              `json:"reaction_count"`
+	Reactions        *ReactionSummary `json:"reactions,omitempty"`
+	Status           string           `json:"status"`
+	CreatedAt        time.Time        `json:"created_at"`
+	EditedAt         *time.Time       `json:"edited_at"`
+	EditCount        int              `json:"edit_count"`
+	Version          int              `json:"version"`
+}
+
+// CommentRevision holds the text a comment had before one of its edits.
+type CommentRevision struct {
+	ID          int64     `json:"id"`
+	CommentID   int64     `json:"comment_id"`
+	EditorID    *int64    `json:"editor_id"`
 	CommentText string    `json:"comment_text"`
-	LikeCount   int       `json:"like_count"`
 	CreatedAt   time.Time `json:"created_at"`
-	Version     int       `json:"-"`
 }
+
+// MarshalJSON adds the sanitized HTML rendering of the Markdown source as
+// comment_html, and a spoiler flag for comments marked as spoilers.
+func (lc LikeComment) MarshalJSON() ([]byte, error) {
+	type likeComment LikeComment
+	return json.Marshal(struct {
+		likeComment
+		Spoiler     bool   `json:"spoiler"`
+		CommentHTML string `json:"comment_html"`
+	}{
+		likeComment: likeComment(lc),
+		Spoiler:     lc.SpoilerEpisodeID != nil,
+		CommentHTML: markdown.Render(lc.CommentText),
+	})
+}
+
+// Redact hides the text of a spoiler comment from readers who have not
+// watched the episode it spoils.
+func (lc *LikeComment) Redact() {
+	lc.CommentText = ""
+	lc.Redacted = true
+}
+
+func (lc *LikeComment) IsAuthor(user *User) bool {
+	return !user.IsAnonymous() && lc.UserID == user.ID
+}
+
 type LikeCommentModel struct {
 	DB       *sql.DB
 	InfoLog  *log.Logger
@@ -27,16 +84,20 @@ type LikeCommentModel struct {
 }
 
 func (lcm *LikeCommentModel) Insert(likeComment *LikeComment) error {
-	query := `INSERT INTO like_comment (user_id, episode_id, comment_text) 
-				VALUES ($1, $2, $3)
-				RETURNING id,created_at`
+	if likeComment.Status == "" {
+		likeComment.Status = CommentStatusVisible
+	}
 
-	args := []interface{}{likeComment.UserID, likeComment.EpisodeID, likeComment.CommentText}
+	query := `INSERT INTO like_comment (user_id, episode_id, parent_id, spoiler_episode_id, comment_text, status)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				RETURNING id, created_at, version`
+
+	args := []interface{}{likeComment.UserID, likeComment.EpisodeID, likeComment.ParentID, likeComment.SpoilerEpisodeID, likeComment.CommentText, likeComment.Status}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return lcm.DB.QueryRowContext(ctx, query, args...).Scan(&likeComment.LikeID, &likeComment.CreatedAt)
+	return lcm.DB.QueryRowContext(ctx, query, args...).Scan(&likeComment.LikeID, &likeComment.CreatedAt, &likeComment.Version)
 }
 
 func (lcm *LikeCommentModel) Delete(likeID int64) error {
@@ -50,28 +111,98 @@ func (lcm *LikeCommentModel) Delete(likeID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := lcm.DB.ExecContext(ctx, query, likeID)
-	return err
+	result, err := lcm.DB.ExecContext(ctx, query, likeID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
 }
 
-func (lcm *LikeCommentModel) Update(likeComment *LikeComment) error {
-	query := `UPDATE like_comment
-				SET comment_text = $1, like_count = $2, version = version + 1
-				WHERE id = $3 AND version = $4
-				RETURNING version`
+// Update saves the comment. When the text changes, the previous text is kept
+// in comment_revisions as edited by editorID and the edit counters advance.
+func (lcm *LikeCommentModel) Update(likeComment *LikeComment, editorID int64) error {
+	query := `WITH previous AS (
+					SELECT id, comment_text FROM like_comment
+					WHERE id = $3 AND version = $4
+					FOR UPDATE
+				), revision AS (
+					INSERT INTO comment_revisions (comment_id, editor_id, comment_text)
+					SELECT id, $5::bigint, comment_text FROM previous
+					WHERE comment_text IS DISTINCT FROM $1
+				)
+				UPDATE like_comment
+				SET comment_text = $1, status = $2, spoiler_episode_id = $6, version = version + 1,
+					edited_at = CASE WHEN previous.comment_text IS DISTINCT FROM $1 THEN NOW() ELSE like_comment.edited_at END,
+					edit_count = like_comment.edit_count + CASE WHEN previous.comment_text IS DISTINCT FROM $1 THEN 1 ELSE 0 END
+				FROM previous
+				WHERE like_comment.id = previous.id
+				RETURNING like_comment.version, like_comment.edited_at, like_comment.edit_count`
 
 	args := []interface{}{
 		likeComment.CommentText,
-		likeComment.LikeCount,
+		likeComment.Status,
 		likeComment.LikeID,
 		likeComment.Version,
+		editorID,
+		likeComment.SpoilerEpisodeID,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	//err := lcm.DB.QueryRowContext(ctx, query, args...).Scan(&likeComment.Version)
-	return lcm.DB.QueryRowContext(ctx, query, args...).Scan(&likeComment.Version)
+	err := lcm.DB.QueryRowContext(ctx, query, args...).Scan(&likeComment.Version, &likeComment.EditedAt, &likeComment.EditCount)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (lcm *LikeCommentModel) GetRevisions(commentID int64) ([]*CommentRevision, error) {
+	query := `SELECT id, comment_id, editor_id, comment_text, created_at
+				FROM comment_revisions
+				WHERE comment_id = $1
+				ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := lcm.DB.QueryContext(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*CommentRevision{}
+	for rows.Next() {
+		var revision CommentRevision
+		err := rows.Scan(
+			&revision.ID,
+			&revision.CommentID,
+			&revision.EditorID,
+			&revision.CommentText,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
 }
 
 func (lcm *LikeCommentModel) Get(id int64) (*LikeComment, error) {
@@ -79,9 +210,14 @@ func (lcm *LikeCommentModel) Get(id int64) (*LikeComment, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT id, user_id, episode_id, comment_text, like_count, created_at, version
+	query := `SELECT like_comment.id, like_comment.user_id, users.name, users.avatar, like_comment.episode_id, like_comment.parent_id, like_comment.spoiler_episode_id,
+				like_comment.comment_text, like_comment.like_count, like_comment.status, like_comment.created_at, like_comment.edited_at, like_comment.edit_count, like_comment.version,
+				(SELECT count(*) FROM comment_reactions WHERE comment_reactions.comment_id = like_comment.id) AS reaction_count,
+				like_comment.pinned, votes.upvotes, votes.downvotes
 				FROM like_comment
-				WHERE id = $1`
+				INNER JOIN users ON users.id = like_comment.user_id
+				CROSS JOIN LATERAL (` + commentVotesQuery + `) votes
+				WHERE like_comment.id = $1`
 
 	var likeComment LikeComment
 
@@ -92,30 +228,62 @@ func (lcm *LikeCommentModel) Get(id int64) (*LikeComment, error) {
 	err := row.Scan(
 		&likeComment.LikeID,
 		&likeComment.UserID,
+		&likeComment.Author.Name,
+		&likeComment.Author.Avatar,
 		&likeComment.EpisodeID,
+		&likeComment.ParentID,
+		&likeComment.SpoilerEpisodeID,
 		&likeComment.CommentText,
 		&likeComment.LikeCount,
+		&likeComment.Status,
 		&likeComment.CreatedAt,
+		&likeComment.EditedAt,
+		&likeComment.EditCount,
 		&likeComment.Version,
+		&likeComment.ReactionCount,
+		&likeComment.Pinned,
+		&likeComment.Upvotes,
+		&likeComment.Downvotes,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("cannot retrive like_comment with id: %v, %w", id, err)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, fmt.Errorf("cannot retrive like_comment with id: %v, %w", id, err)
+		}
 	}
+	likeComment.Author.ID = likeComment.UserID
 	return &likeComment, nil
 }
 
-func (e LikeCommentModel) GetAll(commentText string, filters Filters) ([]*LikeComment, Metadata, error) {
+// GetAll lists comments matching commentText. Hidden comments are only
+// included when includeHidden is set, which handlers do for moderators. The
+// text of a spoiler comment is only searched when viewerID wrote it or has
+// watched the episode it spoils, as it is redacted for anyone else; an
+// anonymous viewer has the ID 0.
+func (e LikeCommentModel) GetAll(commentText string, includeHidden bool, viewerID int64, filters Filters) ([]*LikeComment, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, user_id, episode_id, comment_text, like_count, created_at, version
+		SELECT count(*) OVER(), like_comment.id, like_comment.user_id, users.name, users.avatar, like_comment.episode_id, like_comment.parent_id, like_comment.spoiler_episode_id,
+		like_comment.comment_text, like_comment.like_count, like_comment.status, like_comment.created_at, like_comment.edited_at, like_comment.edit_count, like_comment.version,
+		(SELECT count(*) FROM comment_reactions WHERE comment_reactions.comment_id = like_comment.id) AS reaction_count,
+		like_comment.pinned, votes.upvotes, votes.downvotes
 		FROM like_comment
-		WHERE (to_tsvector('simple',comment_text) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+		INNER JOIN users ON users.id = like_comment.user_id
+		CROSS JOIN LATERAL (%s) votes
+		WHERE ($1 = '' OR (to_tsvector('simple', like_comment.comment_text) @@ plainto_tsquery('simple', $1)
+			AND (like_comment.spoiler_episode_id IS NULL OR like_comment.user_id = $5 OR EXISTS (
+				SELECT 1 FROM watched_episodes
+				WHERE watched_episodes.user_id = $5 AND watched_episodes.episode_id = like_comment.spoiler_episode_id
+			))))
+		AND (like_comment.status <> 'hidden' OR $2)
+		ORDER BY %s, like_comment.id ASC
+		LIMIT $3 OFFSET $4`, commentVotesQuery, commentOrderBy(filters))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := e.DB.QueryContext(ctx, query, commentText, filters.limit(), filters.offset())
+	rows, err := e.DB.QueryContext(ctx, query, commentText, includeHidden, filters.limit(), filters.offset(), viewerID)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -132,16 +300,28 @@ func (e LikeCommentModel) GetAll(commentText string, filters Filters) ([]*LikeCo
 			&totalRecords,
 			&like.LikeID,
 			&like.UserID,
+			&like.Author.Name,
+			&like.Author.Avatar,
 			&like.EpisodeID,
+			&like.ParentID,
+			&like.SpoilerEpisodeID,
 			&like.CommentText,
 			&like.LikeCount,
+			&like.Status,
 			&like.CreatedAt,
+			&like.EditedAt,
+			&like.EditCount,
 			&like.Version,
+			&like.ReactionCount,
+			&like.Pinned,
+			&like.Upvotes,
+			&like.Downvotes,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 
+		like.Author.ID = like.UserID
 		likes = append(likes, &like)
 	}
 
@@ -152,18 +332,28 @@ func (e LikeCommentModel) GetAll(commentText string, filters Filters) ([]*LikeCo
 
 	return likes, metadata, nil
 }
-func (lcm *LikeCommentModel) GetAllByEpisodeID(episodeID int64, filters Filters) ([]*LikeComment, Metadata, error) {
+
+// GetAllByEpisodeID lists the comments of an episode posted since the given
+// time (the zero time lists all of them), pinned comments first.
+func (lcm *LikeCommentModel) GetAllByEpisodeID(episodeID int64, includeHidden bool, since time.Time, filters Filters) ([]*LikeComment, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, user_id, episode_id, comment_text, like_count, created_at, version
+		SELECT count(*) OVER(), like_comment.id, like_comment.user_id, users.name, users.avatar, like_comment.episode_id, like_comment.parent_id, like_comment.spoiler_episode_id,
+		like_comment.comment_text, like_comment.like_count, like_comment.status, like_comment.created_at, like_comment.edited_at, like_comment.edit_count, like_comment.version,
+		(SELECT count(*) FROM comment_reactions WHERE comment_reactions.comment_id = like_comment.id) AS reaction_count,
+		like_comment.pinned, votes.upvotes, votes.downvotes
 		FROM like_comment
-		WHERE episode_id = $1
-		ORDER BY %s %s, id ASC
-		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+		INNER JOIN users ON users.id = like_comment.user_id
+		CROSS JOIN LATERAL (%s) votes
+		WHERE like_comment.episode_id = $1
+		AND (like_comment.status <> 'hidden' OR $2)
+		AND like_comment.created_at >= $3
+		ORDER BY like_comment.pinned DESC, %s, like_comment.id ASC
+		LIMIT $4 OFFSET $5`, commentVotesQuery, commentOrderBy(filters))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := lcm.DB.QueryContext(ctx, query, episodeID, filters.limit(), filters.offset())
+	rows, err := lcm.DB.QueryContext(ctx, query, episodeID, includeHidden, since, filters.limit(), filters.offset())
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -178,15 +368,27 @@ func (lcm *LikeCommentModel) GetAllByEpisodeID(episodeID int64, filters Filters)
 			&totalRecords,
 			&like.LikeID,
 			&like.UserID,
+			&like.Author.Name,
+			&like.Author.Avatar,
 			&like.EpisodeID,
+			&like.ParentID,
+			&like.SpoilerEpisodeID,
 			&like.CommentText,
 			&like.LikeCount,
+			&like.Status,
 			&like.CreatedAt,
+			&like.EditedAt,
+			&like.EditCount,
 			&like.Version,
+			&like.ReactionCount,
+			&like.Pinned,
+			&like.Upvotes,
+			&like.Downvotes,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
+		like.Author.ID = like.UserID
 		likes = append(likes, &like)
 	}
 
@@ -197,11 +399,83 @@ func (lcm *LikeCommentModel) GetAllByEpisodeID(episodeID int64, filters Filters)
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 	return likes, metadata, nil
 }
-func ValidateLike(v *validator.Validator, likeComment *LikeComment) {
+
+const (
+	// commentVotesQuery is joined laterally into the comment listings to
+	// count the votes of each comment.
+	commentVotesQuery = `SELECT count(*) FILTER (WHERE value = 1) AS upvotes, count(*) FILTER (WHERE value = -1) AS downvotes
+		FROM comment_votes WHERE comment_votes.comment_id = like_comment.id`
+
+	// hotScore decays the vote score with age: ten times the votes buy
+	// 12.5 hours. It only depends on the comment itself, so pages stay stable
+	// while a listing is paged through.
+	hotScore = `sign(votes.upvotes - votes.downvotes) * log(greatest(abs(votes.upvotes - votes.downvotes), 1))
+		+ extract(epoch FROM like_comment.created_at) / 45000`
+
+	// controversyScore favours comments with many votes split evenly between
+	// up and down.
+	controversyScore = `CASE WHEN votes.upvotes > 0 AND votes.downvotes > 0
+		THEN power(votes.upvotes + votes.downvotes, least(votes.upvotes, votes.downvotes)::float / greatest(votes.upvotes, votes.downvotes))
+		ELSE 0 END`
+)
+
+// commentOrderBy maps the sort parameter onto an ORDER BY expression for the
+// comment listing queries. The ranking sorts always put the best first.
+func commentOrderBy(filters Filters) string {
+	switch column := filters.sortColumn(); column {
+	case "reactions":
+		return "reaction_count " + filters.sortDirection()
+	case "new":
+		return "like_comment.created_at DESC"
+	case "top":
+		return "(votes.upvotes - votes.downvotes) DESC"
+	case "hot":
+		return "(" + hotScore + ") DESC"
+	case "controversial":
+		return "(" + controversyScore + ") DESC"
+	default:
+		return "like_comment." + column + " " + filters.sortDirection()
+	}
+}
+
+// Vote records the user's vote on a comment, replacing any earlier one.
+func (lcm *LikeCommentModel) Vote(commentID, userID int64, value int) error {
+	query := `INSERT INTO comment_votes (user_id, comment_id, value)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (user_id, comment_id) DO UPDATE SET value = EXCLUDED.value, created_at = NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := lcm.DB.ExecContext(ctx, query, userID, commentID, value)
+	return err
+}
+
+func (lcm *LikeCommentModel) DeleteVote(commentID, userID int64) error {
+	query := `DELETE FROM comment_votes
+				WHERE user_id = $1 AND comment_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := lcm.DB.ExecContext(ctx, query, userID, commentID)
+	return err
+}
+
+func ValidateVote(v *validator.Validator, value int) {
+	v.Check(value == 1 || value == -1, "value", "must be 1 or -1")
+}
+
+// MaxCommentSourceBytes caps the raw Markdown source of a comment, however
+// short its rendering is.
+const MaxCommentSourceBytes = 10_000
+
+func ValidateLike(v *validator.Validator, likeComment *LikeComment, maxLength int) {
 	// Check if the title field is empty.
 	v.Check(likeComment.CommentText != "", "CommentText", "must be provided")
-	// Check if the title field is not more than 100 characters.
-	v.Check(len(likeComment.CommentText) <= 100, "CommentText", "must not be more than 100 bytes long")
+	// Check the length of the comment as readers see it once rendered.
+	v.Check(utf8.RuneCountInString(markdown.PlainText(likeComment.CommentText)) <= maxLength, "CommentText", fmt.Sprintf("must not be more than %d characters long", maxLength))
+	v.Check(len(likeComment.CommentText) <= MaxCommentSourceBytes, "CommentText", fmt.Sprintf("must not be more than %d bytes long", MaxCommentSourceBytes))
 	// Check if the description field is not more than 1000 characters.
 	v.Check(likeComment.LikeCount >= 0, "like_count", "must not be negative")
 
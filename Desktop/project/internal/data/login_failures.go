@@ -0,0 +1,108 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoginFailures counts the failed logins for an email address since its last
+// successful one.
+type LoginFailures struct {
+	Email       string
+	Failures    int
+	LockedUntil *time.Time
+}
+
+// Locked reports whether logins for the address are refused at now.
+func (f *LoginFailures) Locked(now time.Time) bool {
+	return f.LockedUntil != nil && f.LockedUntil.After(now)
+}
+
+// LoginFailureModel tracks failures by email rather than by user, so unknown
+// addresses are throttled exactly like real accounts.
+type LoginFailureModel struct {
+	DB *sql.DB
+}
+
+// Get returns the failures for email, which are zero when none are recorded.
+func (m LoginFailureModel) Get(email string) (*LoginFailures, error) {
+	query := `
+		SELECT email, failures, locked_until
+		FROM login_failures
+		WHERE email = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	f := LoginFailures{Email: email}
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(&f.Email, &f.Failures, &f.LockedUntil)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// RecordFailure counts a failed login and returns the number of failures so
+// far. The count starts over when the previous failure was before since, or
+// when it had reached lockoutAfter and the lockout has expired, so that one
+// more wrong password does not lock the account all over again.
+func (m LoginFailureModel) RecordFailure(email string, since time.Time, lockoutAfter int) (int, error) {
+	query := `
+		INSERT INTO login_failures (email, failures)
+		VALUES ($1, 1)
+		ON CONFLICT (email) DO UPDATE SET
+		failures = CASE
+			WHEN login_failures.last_failure_at < $2
+			OR (login_failures.failures >= $3 AND login_failures.locked_until <= NOW()) THEN 1
+			ELSE login_failures.failures + 1
+		END,
+		last_failure_at = NOW()
+		RETURNING failures`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var failures int
+	err := m.DB.QueryRowContext(ctx, query, email, since, lockoutAfter).Scan(&failures)
+	return failures, err
+}
+
+func (m LoginFailureModel) Lock(email string, until time.Time) error {
+	query := `
+		UPDATE login_failures
+		SET locked_until = $2
+		WHERE email = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, email, until)
+	return err
+}
+
+// Reset forgets the failures for email, lifting any lock.
+func (m LoginFailureModel) Reset(email string) error {
+	query := `
+		DELETE FROM login_failures
+		WHERE email = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, email)
+	return err
+}
+
+// DeleteStale forgets the failures of addresses that last failed before
+// before and are not locked, returning how many were removed.
+func (m LoginFailureModel) DeleteStale(before time.Time) (int, error) {
+	query := `
+		DELETE FROM login_failures
+		WHERE last_failure_at < $1
+		AND (locked_until IS NULL OR locked_until <= NOW())`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return int(rowsAffected), err
+}
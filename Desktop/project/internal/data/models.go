@@ -11,21 +11,47 @@ var (
 )
 
 type Models struct {
-	Movies      EpisodeModel
-	Characters  CharacterModel
-	Tokens      TokenModel
-	Permissions PermissionModel
-	Users       UserModel
-	LikeComment LikeCommentModel
+	Movies        EpisodeModel
+	Characters    CharacterModel
+	Tokens        TokenModel
+	Permissions   PermissionModel
+	Roles         RoleModel
+	Users         UserModel
+	LikeComment   LikeCommentModel
+	Moderation    ModerationModel
+	Notifications NotificationModel
+	Reactions     ReactionModel
+	Watched       WatchedModel
+	Favorites     FavoriteModel
+	Exports       ExportModel
+	Audit         AuditModel
+	Sessions      SessionModel
+	APIKeys       APIKeyModel
+	OAuthClients  OAuthClientModel
+	TOTP          TOTPModel
+	LoginFailures LoginFailureModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:     EpisodeModel{DB: db},
-		Characters: CharacterModel{DB: db},
-		LikeComment: LikeCommentModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		Movies:        EpisodeModel{DB: db},
+		Characters:    CharacterModel{DB: db},
+		LikeComment:   LikeCommentModel{DB: db},
+		Moderation:    ModerationModel{DB: db},
+		Notifications: NotificationModel{DB: db},
+		Reactions:     ReactionModel{DB: db},
+		Watched:       WatchedModel{DB: db},
+		Favorites:     FavoriteModel{DB: db},
+		Exports:       ExportModel{DB: db},
+		Audit:         AuditModel{DB: db},
+		Sessions:      SessionModel{DB: db},
+		APIKeys:       APIKeyModel{DB: db},
+		OAuthClients:  OAuthClientModel{DB: db},
+		TOTP:          TOTPModel{DB: db},
+		LoginFailures: LoginFailureModel{DB: db},
+		Permissions:   PermissionModel{DB: db},
+		Roles:         RoleModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Users:         UserModel{DB: db},
 	}
 }
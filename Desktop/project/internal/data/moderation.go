@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"series.bekarysrymkhanov.net/internal/validator"
+)
+
+const (
+	CommentStatusVisible = "visible"
+	CommentStatusFlagged = "flagged"
+	CommentStatusHidden  = "hidden"
+)
+
+const (
+	ModerationActionApprove = "approve"
+	ModerationActionHide    = "hide"
+	ModerationActionDelete  = "delete"
+	ModerationActionBan     = "ban"
+	ModerationActionPin     = "pin"
+	ModerationActionUnpin   = "unpin"
+	// ModerationActionEdit is logged when a moderator edits someone else's
+	// comment. It is not a moderation request action.
+	ModerationActionEdit = "edit"
+)
+
+var ErrDuplicateReport = errors.New("duplicate report")
+
+type CommentReport struct {
+	ID        int64     `json:"id"`
+	CommentID int64     `json:"comment_id"`
+	UserID    int64     `json:"-"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ModerationQueueEntry struct {
+	Comment     *LikeComment `json:"comment"`
+	ReportCount int          `json:"report_count"`
+	Reasons     []string     `json:"reasons"`
+}
+
+type ModerationAction struct {
+	ID          int64     `json:"id"`
+	ModeratorID int64     `json:"moderator_id"`
+	CommentID   int64     `json:"comment_id"`
+	AuthorID    int64     `json:"author_id"`
+	Action      string    `json:"action"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func ValidateReport(v *validator.Validator, report *CommentReport) {
+	v.Check(report.Reason != "", "reason", "must be provided")
+	v.Check(len(report.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+}
+
+func ValidateModerationAction(v *validator.Validator, action *ModerationAction) {
+	v.Check(action.Action != "", "action", "must be provided")
+	v.Check(validator.In(action.Action, ModerationActionApprove, ModerationActionHide, ModerationActionDelete, ModerationActionBan, ModerationActionPin, ModerationActionUnpin), "action", "must be one of approve, hide, delete, ban, pin or unpin")
+	v.Check(len(action.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+}
+
+type ModerationModel struct {
+	DB *sql.DB
+}
+
+func (m ModerationModel) InsertReport(report *CommentReport) error {
+	query := `
+		INSERT INTO comment_reports (comment_id, user_id, reason)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, report.CommentID, report.UserID, report.Reason).Scan(&report.ID, &report.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "comment_reports_comment_id_user_id_key"`:
+			return ErrDuplicateReport
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m ModerationModel) DeleteReportsForComment(commentID int64) error {
+	query := `
+		DELETE FROM comment_reports
+		WHERE comment_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, commentID)
+	return err
+}
+
+func (m ModerationModel) SetCommentStatus(commentID int64, status string) error {
+	query := `
+		UPDATE like_comment
+		SET status = $1, version = version + 1
+		WHERE id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, status, commentID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetCommentPinned pins a comment to the top of its episode's listing, or
+// unpins it.
+func (m ModerationModel) SetCommentPinned(commentID int64, pinned bool) error {
+	query := `
+		UPDATE like_comment
+		SET pinned = $1, version = version + 1
+		WHERE id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, pinned, commentID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Queue lists comments that were reported by users or flagged automatically,
+// most reported first. Hidden comments have been dealt with and are left out,
+// though their reports are kept.
+func (m ModerationModel) Queue(filters Filters) ([]*ModerationQueueEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), like_comment.id, like_comment.user_id, users.name, users.avatar, like_comment.episode_id, like_comment.parent_id, like_comment.spoiler_episode_id,
+		like_comment.comment_text, like_comment.like_count, like_comment.status, like_comment.created_at, like_comment.edited_at, like_comment.edit_count, like_comment.version,
+		count(comment_reports.id) AS report_count, array_remove(array_agg(comment_reports.reason ORDER BY comment_reports.id), NULL)
+		FROM like_comment
+		INNER JOIN users ON users.id = like_comment.user_id
+		LEFT JOIN comment_reports ON comment_reports.comment_id = like_comment.id
+		GROUP BY like_comment.id, users.id
+		HAVING like_comment.status <> 'hidden'
+		AND (count(comment_reports.id) > 0 OR like_comment.status = 'flagged')
+		ORDER BY %s %s, like_comment.id ASC
+		LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*ModerationQueueEntry{}
+
+	for rows.Next() {
+		var like LikeComment
+		entry := ModerationQueueEntry{Comment: &like}
+
+		err := rows.Scan(
+			&totalRecords,
+			&like.LikeID,
+			&like.UserID,
+			&like.Author.Name,
+			&like.Author.Avatar,
+			&like.EpisodeID,
+			&like.ParentID,
+			&like.SpoilerEpisodeID,
+			&like.CommentText,
+			&like.LikeCount,
+			&like.Status,
+			&like.CreatedAt,
+			&like.EditedAt,
+			&like.EditCount,
+			&like.Version,
+			&entry.ReportCount,
+			pq.Array(&entry.Reasons),
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		like.Author.ID = like.UserID
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
+
+func (m ModerationModel) LogAction(action *ModerationAction) error {
+	query := `
+		INSERT INTO moderation_log (moderator_id, comment_id, author_id, action, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+	args := []interface{}{action.ModeratorID, action.CommentID, action.AuthorID, action.Action, action.Reason}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&action.ID, &action.CreatedAt)
+}
@@ -0,0 +1,237 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"series.bekarysrymkhanov.net/internal/validator"
+)
+
+const (
+	NotificationMention         = "mention"
+	NotificationReply           = "reply"
+	NotificationFavoriteComment = "favorite_comment"
+)
+
+var NotificationTypes = []string{NotificationMention, NotificationReply, NotificationFavoriteComment}
+
+var mentionRX = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]+)`)
+
+// ParseMentions returns the distinct usernames mentioned as @username in
+// text, lower-cased and in order of first appearance.
+func ParseMentions(text string) []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, match := range mentionRX.FindAllStringSubmatch(text, -1) {
+		name := strings.ToLower(strings.TrimRight(match[1], ".-"))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+type Notification struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"-"`
+	Type      string     `json:"type"`
+	ActorID   int64      `json:"actor_id"`
+	CommentID int64      `json:"comment_id"`
+	EpisodeID int64      `json:"episode_id"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func ValidateNotificationPreferences(v *validator.Validator, preferences map[string]bool) {
+	v.Check(len(preferences) > 0, "muted", "must be provided")
+	for notificationType := range preferences {
+		v.Check(validator.In(notificationType, NotificationTypes...), "muted", fmt.Sprintf("unknown notification type %q", notificationType))
+	}
+}
+
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+// InsertForComment stores the notifications for a new comment in one
+// statement: one for each of recipients, of the type at the same index, and
+// one of type favorite_comment for every user who favorited the episode. A
+// user listed more than once gets a single notification of the first type
+// listed, and a favorite only counts for users not listed. Nothing is stored
+// for the actor or for a user who muted the type. It returns the
+// notifications created.
+func (m NotificationModel) InsertForComment(actorID, commentID, episodeID int64, recipients []int64, types []string) ([]*Notification, error) {
+	query := `
+		INSERT INTO notifications (user_id, type, actor_id, comment_id, episode_id)
+		SELECT chosen.user_id, chosen.type, $3::bigint, $4::bigint, $5::bigint
+		FROM (
+			SELECT DISTINCT ON (user_id) user_id, type
+			FROM (
+				SELECT user_id, type, rank
+				FROM unnest($1::bigint[], $2::text[]) WITH ORDINALITY AS listed (user_id, type, rank)
+				UNION ALL
+				SELECT user_id, $6::text, NULL
+				FROM favorite_episodes
+				WHERE episode_id = $5
+			) AS candidates
+			ORDER BY user_id, rank NULLS LAST
+		) AS chosen
+		WHERE chosen.user_id <> $3
+		AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences
+			WHERE notification_preferences.user_id = chosen.user_id
+			AND notification_preferences.type = chosen.type
+			AND muted
+		)
+		RETURNING id, user_id, type, created_at`
+	args := []interface{}{pq.Array(recipients), pq.Array(types), actorID, commentID, episodeID, NotificationFavoriteComment}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		notification := Notification{ActorID: actorID, CommentID: commentID, EpisodeID: episodeID}
+		err := rows.Scan(&notification.ID, &notification.UserID, &notification.Type, &notification.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, &notification)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (m NotificationModel) GetAllForUser(userID int64, unreadOnly bool, filters Filters) ([]*Notification, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, type, actor_id, comment_id, episode_id, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1
+		AND (read_at IS NULL OR NOT $2)
+		ORDER BY %s %s, id DESC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, unreadOnly, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	notifications := []*Notification{}
+
+	for rows.Next() {
+		notification := Notification{UserID: userID}
+		err := rows.Scan(
+			&totalRecords,
+			&notification.ID,
+			&notification.Type,
+			&notification.ActorID,
+			&notification.CommentID,
+			&notification.EpisodeID,
+			&notification.ReadAt,
+			&notification.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		notifications = append(notifications, &notification)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return notifications, metadata, nil
+}
+
+func (m NotificationModel) UnreadCount(userID int64) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks the given notifications of the user as read, or all of them
+// when ids is empty.
+func (m NotificationModel) MarkRead(userID int64, ids []int64) error {
+	query := `
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL
+		AND (id = ANY($2) OR cardinality($2::bigint[]) = 0)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(ids))
+	return err
+}
+
+// GetPreferences returns the muted state of every notification type for the
+// user. Types without a stored preference are not muted.
+func (m NotificationModel) GetPreferences(userID int64) (map[string]bool, error) {
+	preferences := make(map[string]bool, len(NotificationTypes))
+	for _, notificationType := range NotificationTypes {
+		preferences[notificationType] = false
+	}
+
+	query := `
+		SELECT type, muted
+		FROM notification_preferences
+		WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			notificationType string
+			muted            bool
+		)
+		if err := rows.Scan(&notificationType, &muted); err != nil {
+			return nil, err
+		}
+		preferences[notificationType] = muted
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return preferences, nil
+}
+
+func (m NotificationModel) SetPreference(userID int64, notificationType string, muted bool) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, type, muted)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, type) DO UPDATE SET muted = EXCLUDED.muted`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, notificationType, muted)
+	return err
+}
@@ -0,0 +1,214 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"series.bekarysrymkhanov.net/internal/validator"
+)
+
+var ErrDuplicateOAuthClientName = errors.New("duplicate oauth client name")
+
+// OAuthClient lets a service account obtain access tokens with the OAuth 2.0
+// client credentials grant. Only the hash of its secret is stored; the secret
+// is shown once, when the client is created.
+type OAuthClient struct {
+	ID         int64       `json:"id"`
+	UserID     int64       `json:"user_id"`
+	Name       string      `json:"name"`
+	ClientID   string      `json:"client_id"`
+	Secret     string      `json:"client_secret,omitempty"`
+	SecretHash []byte      `json:"-"`
+	Scopes     Permissions `json:"scopes"`
+	CreatedAt  time.Time   `json:"created_at"`
+	LastUsedAt *time.Time  `json:"last_used_at"`
+}
+
+// ParseScope splits an OAuth scope parameter into permission codes. Scopes
+// are our permission codes, so retired codes are mapped to their
+// replacements.
+func ParseScope(scope string) Permissions {
+	var codes Permissions
+	for _, code := range strings.Fields(scope) {
+		codes = append(codes, CanonicalPermission(code))
+	}
+	return codes
+}
+
+// FormatScope joins permission codes into an OAuth scope parameter.
+func FormatScope(codes Permissions) string {
+	return strings.Join(codes, " ")
+}
+
+// ValidateOAuthClient checks a new client against the permissions its owner
+// holds.
+func ValidateOAuthClient(v *validator.Validator, client *OAuthClient, ownerPermissions Permissions) {
+	v.Check(client.Name != "", "name", "must be provided")
+	v.Check(len(client.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(client.Scopes) > 0, "scopes", "must contain at least one scope")
+	v.Check(validator.Unique(client.Scopes), "scopes", "must not contain duplicate values")
+	for _, code := range client.Scopes {
+		v.Check(code != "" && !strings.ContainsAny(code, " \"\\"), "scopes", "must not contain spaces, quotes or backslashes")
+		v.Check(ownerPermissions.Include(code), "scopes", "must be a subset of the service account's permissions")
+	}
+}
+
+type OAuthClientModel struct {
+	DB *sql.DB
+}
+
+// Insert generates the client ID and secret and stores the client, leaving
+// the secret on client for the caller to show.
+func (m OAuthClientModel) Insert(client *OAuthClient) error {
+	clientID, err := randomPlaintext()
+	if err != nil {
+		return err
+	}
+	secret, err := randomPlaintext()
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(secret))
+	client.ClientID = strings.ToLower(clientID)
+	client.Secret = secret
+	client.SecretHash = hash[:]
+
+	query := `
+		INSERT INTO oauth_clients (user_id, name, client_id, secret_hash, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+	args := []interface{}{client.UserID, client.Name, client.ClientID, client.SecretHash, pq.Array(client.Scopes)}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&client.ID, &client.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "oauth_clients_user_id_name_key"`:
+			return ErrDuplicateOAuthClientName
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m OAuthClientModel) GetAllForUser(userID int64) ([]*OAuthClient, error) {
+	query := `
+		SELECT id, user_id, name, client_id, scopes, created_at, last_used_at
+		FROM oauth_clients
+		WHERE user_id = $1
+		ORDER BY id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []*OAuthClient{}
+	for rows.Next() {
+		var client OAuthClient
+		err := rows.Scan(
+			&client.ID,
+			&client.UserID,
+			&client.Name,
+			&client.ClientID,
+			pq.Array(&client.Scopes),
+			&client.CreatedAt,
+			&client.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, &client)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// GetForCredentials returns the client with the given ID and secret together
+// with its owner and records that it was used. Clients of deleted users are
+// not returned.
+func (m OAuthClientModel) GetForCredentials(clientID, secret string) (*OAuthClient, *User, error) {
+	hash := sha256.Sum256([]byte(secret))
+	query := `
+		UPDATE oauth_clients
+		SET last_used_at = NOW()
+		FROM users
+		WHERE oauth_clients.client_id = $1
+		AND oauth_clients.secret_hash = $2
+		AND users.id = oauth_clients.user_id
+		AND users.deleted_at IS NULL
+		RETURNING oauth_clients.id, oauth_clients.name, oauth_clients.client_id, oauth_clients.scopes,
+		oauth_clients.created_at, oauth_clients.last_used_at,
+		users.id, users.created_at, users.name, COALESCE(users.username, ''), users.email, users.avatar, users.activated, users.banned,
+		users.service_account, users.version`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		client OAuthClient
+		user   User
+	)
+	err := m.DB.QueryRowContext(ctx, query, clientID, hash[:]).Scan(
+		&client.ID,
+		&client.Name,
+		&client.ClientID,
+		pq.Array(&client.Scopes),
+		&client.CreatedAt,
+		&client.LastUsedAt,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Username,
+		&user.Email,
+		&user.Avatar,
+		&user.Activated,
+		&user.Banned,
+		&user.ServiceAccount,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	client.UserID = user.ID
+	return &client, &user, nil
+}
+
+// Delete removes the client, revoking the tokens issued to it, and returns
+// it for the audit log.
+func (m OAuthClientModel) Delete(id int64) (*OAuthClient, error) {
+	query := `
+		DELETE FROM oauth_clients
+		WHERE id = $1
+		RETURNING user_id, name, client_id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	client := OAuthClient{ID: id}
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&client.UserID, &client.Name, &client.ClientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &client, nil
+}
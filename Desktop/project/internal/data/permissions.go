@@ -4,31 +4,84 @@ import (
 	"context"
 	"database/sql"
 	"github.com/lib/pq"
+	"strings"
 	"time"
 )
 
 type Permissions []string
 
+// permissionAliases maps retired permission codes to the ones that replaced
+// them, so that API keys, signed tokens and configuration using the old codes
+// keep working.
+var permissionAliases = map[string]string{
+	"movies:read":  "episodes:read",
+	"movies:write": "episodes:write",
+	"movies:*":     "episodes:*",
+}
+
+// CanonicalPermission returns the current code for a possibly retired one.
+func CanonicalPermission(code string) string {
+	if canonical, ok := permissionAliases[code]; ok {
+		return canonical
+	}
+	return code
+}
+
+// permissionCovers reports whether the granted code covers code. A granted
+// code ending in "*" covers every code it is a prefix of, so "episodes:*"
+// covers "episodes:read" and "*" covers everything.
+func permissionCovers(granted, code string) bool {
+	granted, code = CanonicalPermission(granted), CanonicalPermission(code)
+	if prefix, ok := strings.CutSuffix(granted, "*"); ok {
+		return strings.HasPrefix(code, prefix)
+	}
+	return granted == code
+}
+
 func (p Permissions) Include(code string) bool {
 	for i := range p {
-		if code == p[i] {
+		if permissionCovers(p[i], code) {
 			return true
 		}
 	}
 	return false
 }
 
+// Intersect returns the codes covered by both p and other.
+func (p Permissions) Intersect(other Permissions) Permissions {
+	var intersection Permissions
+	for _, code := range other {
+		if p.Include(code) {
+			intersection = append(intersection, code)
+		}
+	}
+	// Narrower codes of p that a wildcard of other covers.
+	for _, code := range p {
+		if other.Include(code) && !intersection.Include(code) {
+			intersection = append(intersection, code)
+		}
+	}
+	return intersection
+}
+
 type PermissionModel struct {
 	DB *sql.DB
 }
 
+// GetAllForUser returns the effective permissions of the user: those granted
+// directly and those of their roles.
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	query := `
 		SELECT permissions.code
 		FROM permissions
 		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-		INNER JOIN users ON users_permissions.user_id = users.id
-		WHERE users.id = $1`
+		WHERE users_permissions.user_id = $1
+		UNION
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+		INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+		WHERE users_roles.user_id = $1`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	rows, err := m.DB.QueryContext(ctx, query, userID)
@@ -50,12 +103,85 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	}
 	return permissions, nil
 }
+
+// GetGrantedForUser returns the permissions granted to the user directly,
+// leaving out those of their roles.
+func (m PermissionModel) GetGrantedForUser(userID int64) (Permissions, error) {
+	query := `
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+		WHERE users_permissions.user_id = $1
+		ORDER BY permissions.code`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	permissions := Permissions{}
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
 func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	query := `
 		INSERT INTO users_permissions
-		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+		DELETE FROM users_permissions
+		USING permissions
+		WHERE users_permissions.permission_id = permissions.id
+		AND users_permissions.user_id = $1
+		AND permissions.code = ANY($2)`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
+
+// GetAll returns every permission code there is.
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+		SELECT code
+		FROM permissions
+		ORDER BY code`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	permissions := Permissions{}
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
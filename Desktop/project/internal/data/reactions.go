@@ -0,0 +1,135 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"series.bekarysrymkhanov.net/internal/validator"
+)
+
+// ReactionTarget selects which kind of record a reaction is attached to. Each
+// target has its own table so that deleting the record cascades.
+type ReactionTarget int8
+
+const (
+	ReactionTargetComment ReactionTarget = iota
+	ReactionTargetEpisode
+)
+
+func (t ReactionTarget) table() string {
+	switch t {
+	case ReactionTargetEpisode:
+		return "episode_reactions"
+	default:
+		return "comment_reactions"
+	}
+}
+
+func (t ReactionTarget) column() string {
+	switch t {
+	case ReactionTargetEpisode:
+		return "episode_id"
+	default:
+		return "comment_id"
+	}
+}
+
+type ReactionSummary struct {
+	Counts map[string]int `json:"counts"`
+	Mine   []string       `json:"mine"`
+}
+
+func newReactionSummary() *ReactionSummary {
+	return &ReactionSummary{Counts: map[string]int{}, Mine: []string{}}
+}
+
+func ValidateReaction(v *validator.Validator, emoji string, allowed []string) {
+	v.Check(emoji != "", "emoji", "must be provided")
+	v.Check(validator.In(emoji, allowed...), "emoji", "is not a supported reaction")
+}
+
+type ReactionModel struct {
+	DB *sql.DB
+}
+
+func (m ReactionModel) Add(target ReactionTarget, targetID, userID int64, emoji string) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (user_id, %s, emoji)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, target.table(), target.column())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, targetID, emoji)
+	return err
+}
+
+func (m ReactionModel) Remove(target ReactionTarget, targetID, userID int64, emoji string) error {
+	query := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE user_id = $1 AND %s = $2 AND emoji = $3`, target.table(), target.column())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, targetID, emoji)
+	return err
+}
+
+// Summaries returns the reaction counts for each of the given records along
+// with the reactions userID made on them. Every requested ID is present in
+// the result, even when nobody reacted.
+func (m ReactionModel) Summaries(target ReactionTarget, targetIDs []int64, userID int64) (map[int64]*ReactionSummary, error) {
+	summaries := make(map[int64]*ReactionSummary, len(targetIDs))
+	for _, id := range targetIDs {
+		summaries[id] = newReactionSummary()
+	}
+	if len(targetIDs) == 0 {
+		return summaries, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %[2]s, emoji, count(*), bool_or(user_id = $2)
+		FROM %[1]s
+		WHERE %[2]s = ANY($1)
+		GROUP BY %[2]s, emoji
+		ORDER BY %[2]s, count(*) DESC, emoji`, target.table(), target.column())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(targetIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			targetID int64
+			emoji    string
+			count    int
+			mine     bool
+		)
+		err := rows.Scan(&targetID, &emoji, &count, &mine)
+		if err != nil {
+			return nil, err
+		}
+		summary := summaries[targetID]
+		summary.Counts[emoji] = count
+		if mine {
+			summary.Mine = append(summary.Mine, emoji)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (m ReactionModel) Summary(target ReactionTarget, targetID, userID int64) (*ReactionSummary, error) {
+	summaries, err := m.Summaries(target, []int64{targetID}, userID)
+	if err != nil {
+		return nil, err
+	}
+	return summaries[targetID], nil
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"time"
+)
+
+// Session groups the authentication and refresh tokens issued from one login.
+type Session struct {
+	ID         int64     `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// GetAllForUser lists the sessions of the user that still hold an unexpired
+// token, most recently used first. The session of currentToken is marked as
+// current.
+func (m SessionModel) GetAllForUser(userID int64, currentToken string) ([]*Session, error) {
+	hash := sha256.Sum256([]byte(currentToken))
+	query := `
+		SELECT id, user_agent, ip, created_at, last_used_at,
+		EXISTS (SELECT 1 FROM tokens WHERE tokens.session_id = sessions.id AND tokens.hash = $2)
+		FROM sessions
+		WHERE user_id = $1
+		AND EXISTS (SELECT 1 FROM tokens WHERE tokens.session_id = sessions.id AND tokens.expiry > NOW())
+		ORDER BY last_used_at DESC, id DESC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Delete revokes a session of the user together with all of its tokens.
+func (m SessionModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM sessions
+		WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAllForUserExcept revokes every session of the user but the current
+// one, named by the token the request was made with or by its ID for signed
+// tokens, along with any token of the user issued outside a session.
+func (m SessionModel) DeleteAllForUserExcept(userID int64, currentToken string, currentID int64) error {
+	hash := sha256.Sum256([]byte(currentToken))
+	query := `
+		WITH sessions_deleted AS (
+			DELETE FROM sessions
+			WHERE user_id = $1 AND id <> $3
+			AND NOT EXISTS (SELECT 1 FROM tokens WHERE tokens.session_id = sessions.id AND tokens.hash = $2)
+		)
+		DELETE FROM tokens
+		WHERE user_id = $1 AND session_id IS NULL AND hash <> $2
+		AND scope IN ($4, $5)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, hash[:], currentID, ScopeAuthentication, ScopeRefresh)
+	return err
+}
+
+// Touch records that the session of an authentication token was just used.
+// It writes at most once a minute per session.
+func (m SessionModel) Touch(tokenPlaintext string) error {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		UPDATE sessions
+		SET last_used_at = NOW()
+		FROM tokens
+		WHERE tokens.hash = $1 AND sessions.id = tokens.session_id
+		AND sessions.last_used_at < NOW() - INTERVAL '1 minute'`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, hash[:])
+	return err
+}
@@ -6,6 +6,8 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
+	"github.com/lib/pq"
 	"series.bekarysrymkhanov.net/internal/validator"
 	"time"
 )
@@ -13,14 +15,28 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	Scope2FAPending     = "2fa-pending"
+	ScopeUnlock         = "unlock"
+	ScopeEmailChange    = "email-change"
 )
 
+// ErrTokenReused is returned when a refresh token that was already rotated is
+// presented again. Its whole session has been revoked by then.
+var ErrTokenReused = errors.New("refresh token reused")
+
 type Token struct {
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	SessionID int64     `json:"-"`
+	// ClientID and Permissions are set on tokens issued to OAuth clients,
+	// which may only use the permissions they were granted.
+	ClientID    int64       `json:"-"`
+	Permissions Permissions `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -30,18 +46,28 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 		Expiry: time.Now().Add(ttl),
 		Scope:  scope,
 	}
-	randomBytes := make([]byte, 16)
-
-	_, err := rand.Read(randomBytes)
+	var err error
+	token.Plaintext, err = randomPlaintext()
 	if err != nil {
 		return nil, err
 	}
-	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
 
 	hash := sha256.Sum256([]byte(token.Plaintext))
 	token.Hash = hash[:]
 	return token, nil
 }
+
+// randomPlaintext returns 16 random bytes encoded as 26 base32 characters.
+func randomPlaintext() (string, error) {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
@@ -60,16 +86,64 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 func (m TokenModel) Insert(token *Token) error {
+	return insertToken(context.Background(), m.DB, token)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertToken(ctx context.Context, db execer, token *Token) error {
 	query := `
-INSERT INTO tokens (hash, user_id, expiry, scope)
-VALUES ($1, $2, $3, $4)`
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+INSERT INTO tokens (hash, user_id, expiry, scope, session_id, oauth_client_id, permissions)
+VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($6, 0), $7)`
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.SessionID, token.ClientID, pq.Array(token.Permissions)}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	_, err := db.ExecContext(ctx, query, args...)
 	return err
 }
 
+// NewForClient issues an authentication token to an OAuth client, limited to
+// the given permissions. It belongs to no session and has no refresh token.
+func (m TokenModel) NewForClient(client *OAuthClient, ttl time.Duration, permissions Permissions) (*Token, error) {
+	token, err := generateToken(client.UserID, ttl, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	token.ClientID = client.ID
+	token.Permissions = permissions
+
+	err = m.Insert(token)
+	return token, err
+}
+
+// GetPermissions returns the permissions an authentication token is limited
+// to, or nil when it may use all of its user's.
+func (m TokenModel) GetPermissions(tokenPlaintext string) (Permissions, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+SELECT permissions
+FROM tokens
+WHERE hash = $1 AND scope = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var permissions Permissions
+	err := m.DB.QueryRowContext(ctx, query, hash[:], ScopeAuthentication).Scan(pq.Array(&permissions))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return permissions, nil
+}
+
 func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	query := `
 DELETE FROM tokens
@@ -79,3 +153,164 @@ WHERE scope = $1 AND user_id = $2`
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// NewSession starts a session: an authentication token and the refresh
+// token that can be exchanged for the next pair. The client's user agent and
+// IP address are recorded with it. With a zero accessTTL only the refresh
+// token is issued, for callers that sign their own access tokens.
+func (m TokenModel) NewSession(userID int64, userAgent, ip string, accessTTL, refreshTTL time.Duration) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+INSERT INTO sessions (user_id, user_agent, ip)
+VALUES ($1, $2, $3)
+RETURNING id`
+
+	var sessionID int64
+	err = tx.QueryRowContext(ctx, query, userID, userAgent, ip).Scan(&sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := newTokenPair(ctx, tx, userID, sessionID, accessTTL, refreshTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, tx.Commit()
+}
+
+// Rotate exchanges a refresh token for a new authentication and refresh
+// token in the same session, skipping the former for a zero accessTTL as
+// NewSession does. Each refresh token can be used once: presenting
+// a used one again means it leaked, so the whole session is revoked and
+// ErrTokenReused returned.
+func (m TokenModel) Rotate(refreshPlaintext, userAgent, ip string, accessTTL, refreshTTL time.Duration) (*Token, *Token, error) {
+	hash := sha256.Sum256([]byte(refreshPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE tokens
+SET used_at = NOW()
+WHERE hash = $1 AND scope = $2 AND used_at IS NULL AND expiry > NOW()
+RETURNING user_id, session_id`
+
+	var (
+		userID    int64
+		sessionID int64
+	)
+	err = tx.QueryRowContext(ctx, query, hash[:], ScopeRefresh).Scan(&userID, &sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, m.revokeReused(ctx, tx, hash[:])
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query = `
+UPDATE sessions
+SET user_agent = $1, ip = $2, last_used_at = NOW()
+WHERE id = $3`
+
+	_, err = tx.ExecContext(ctx, query, userAgent, ip, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := newTokenPair(ctx, tx, userID, sessionID, accessTTL, refreshTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, tx.Commit()
+}
+
+// revokeReused deletes the session of a refresh token that has already been
+// used and returns ErrTokenReused, or ErrRecordNotFound when the token is
+// simply unknown or expired.
+func (m TokenModel) revokeReused(ctx context.Context, tx *sql.Tx, hash []byte) error {
+	query := `
+DELETE FROM sessions
+WHERE id = (
+	SELECT session_id FROM tokens
+	WHERE hash = $1 AND scope = $2 AND used_at IS NOT NULL
+)`
+	result, err := tx.ExecContext(ctx, query, hash, ScopeRefresh)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return ErrTokenReused
+}
+
+// Revoke logs out the session an authentication token belongs to, taking its
+// refresh token with it. Tokens issued outside a session are deleted alone.
+func (m TokenModel) Revoke(tokenPlaintext string) error {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+WITH token AS (
+	DELETE FROM tokens
+	WHERE hash = $1 AND scope = $2
+	RETURNING session_id
+)
+DELETE FROM sessions
+WHERE id = (SELECT session_id FROM token)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, hash[:], ScopeAuthentication)
+	return err
+}
+
+func newTokenPair(ctx context.Context, tx *sql.Tx, userID, sessionID int64, accessTTL, refreshTTL time.Duration) (*Token, *Token, error) {
+	refresh, err := generateToken(userID, refreshTTL, ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	refresh.SessionID = sessionID
+
+	err = insertToken(ctx, tx, refresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if accessTTL == 0 {
+		return nil, refresh, nil
+	}
+
+	access, err := generateToken(userID, accessTTL, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+	access.SessionID = sessionID
+
+	err = insertToken(ctx, tx, access)
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, nil
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"series.bekarysrymkhanov.net/internal/validator"
+)
+
+// TOTP is a user's authenticator enrollment. It only protects logins once
+// Confirmed, which happens when the user proves the app produces valid codes.
+type TOTP struct {
+	UserID      int64
+	Secret      string
+	Confirmed   bool
+	LastCounter int64
+}
+
+// RecoveryCodeCount is how many one-time recovery codes a user gets.
+const RecoveryCodeCount = 10
+
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) <= 32, "code", "must not be more than 32 bytes long")
+}
+
+// NormalizeRecoveryCode strips the formatting of a recovery code so that it
+// can be typed with or without dashes and in any case.
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// GenerateRecoveryCodes returns new recovery codes formatted as XXXXX-XXXXX.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		plaintext, err := randomPlaintext()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = plaintext[:5] + "-" + plaintext[5:10]
+	}
+	return codes, nil
+}
+
+type TOTPModel struct {
+	DB *sql.DB
+}
+
+func (m TOTPModel) GetForUser(userID int64) (*TOTP, error) {
+	query := `
+		SELECT user_id, secret, confirmed, last_counter
+		FROM user_totp
+		WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t TOTP
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&t.UserID, &t.Secret, &t.Confirmed, &t.LastCounter)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// Enabled reports whether the user has a confirmed authenticator.
+func (m TOTPModel) Enabled(userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND confirmed)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var enabled bool
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// SetPending stores a new unconfirmed secret for the user, replacing an
+// earlier unconfirmed one. It returns ErrEditConflict when the user already
+// has a confirmed authenticator.
+func (m TOTPModel) SetPending(userID int64, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_counter = 0, created_at = NOW()
+		WHERE NOT user_totp.confirmed`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	return nil
+}
+
+// Confirm enables the user's pending authenticator and replaces their
+// recovery codes.
+func (m TOTPModel) Confirm(userID, counter int64, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE user_totp
+		SET confirmed = true, last_counter = $2
+		WHERE user_id = $1 AND NOT confirmed`
+	result, err := tx.ExecContext(ctx, query, userID, counter)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	hashes := make([][]byte, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		hash := sha256.Sum256([]byte(NormalizeRecoveryCode(code)))
+		hashes[i] = hash[:]
+	}
+	query = `
+		INSERT INTO totp_recovery_codes (user_id, hash)
+		SELECT $1, unnest($2::bytea[])`
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(hashes))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseCounter records that the code for counter was used, failing when that or
+// a later code was used before so that codes cannot be replayed.
+func (m TOTPModel) UseCounter(userID, counter int64) (bool, error) {
+	query := `
+		UPDATE user_totp
+		SET last_counter = $2
+		WHERE user_id = $1 AND confirmed AND last_counter < $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode spends one of the user's recovery codes.
+func (m TOTPModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	hash := sha256.Sum256([]byte(NormalizeRecoveryCode(code)))
+	query := `
+		UPDATE totp_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, hash[:])
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// Delete removes the user's authenticator and recovery codes.
+func (m TOTPModel) Delete(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
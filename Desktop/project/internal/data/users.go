@@ -5,7 +5,10 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
+	"regexp"
 	"series.bekarysrymkhanov.net/internal/validator"
 	"time"
 )
@@ -13,14 +16,19 @@ import (
 var AnonymousUser = &User{}
 
 type User struct {
-	ID               int64     `json:"id"`
-	CreatedAt        time.Time `json:"created_at"`
-	Name             string    `json:"name"`
-	Email            string    `json:"email"`
-	FavoriteEpisodes []int     `json:"favorite_episodes"`
-	Password         password  `json:"-"`
-	Activated        bool      `json:"activated"`
-	Version          int       `json:"-"`
+	ID             int64      `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Name           string     `json:"name"`
+	Username       string     `json:"username"`
+	Email          string     `json:"email"`
+	Avatar         string     `json:"avatar"`
+	Password       password   `json:"-"`
+	Activated      bool       `json:"activated"`
+	Banned         bool       `json:"banned"`
+	ServiceAccount bool       `json:"service_account"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	Anonymized     bool       `json:"-"`
+	Version        int        `json:"version"`
 }
 
 type password struct {
@@ -49,6 +57,18 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	}
 	return true, nil
 }
+
+// dummyPasswordHash is compared against when there is no user to check a
+// password for, with the same cost as real hashes.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), 12)
+
+// DummyPasswordCheck takes as long as Matches without checking anything, so
+// that a login for an unknown email takes as long as one with a wrong
+// password.
+func DummyPasswordCheck(plaintextPassword string) {
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(plaintextPassword))
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
@@ -58,9 +78,23 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
 	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
 }
+
+// ValidateUsername checks a username, which is what @mentions refer to. It
+// may only hold letters, digits, underscores, dots and hyphens, and must not
+// start or end with a dot or hyphen, so that a mention ends where it should.
+func ValidateUsername(v *validator.Validator, username string) {
+	v.Check(len(username) >= 3, "username", "must be at least 3 bytes long")
+	v.Check(len(username) <= 30, "username", "must not be more than 30 bytes long")
+	v.Check(validator.Matches(username, UsernameRX), "username", "must contain only letters, digits, underscores, dots and hyphens, and start and end with a letter, digit or underscore")
+}
+
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Name != "", "name", "must be provided")
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+	if user.Username != "" {
+		ValidateUsername(v, user.Username)
+	}
+	v.Check(len(user.Avatar) <= 2048, "avatar", "must not be more than 2048 bytes long")
 	ValidateEmail(v, user.Email)
 
 	if user.Password.plaintext != nil {
@@ -77,15 +111,19 @@ type UserModel struct {
 }
 
 var (
-	ErrDuplicateEmail = errors.New("duplicate email")
+	ErrDuplicateEmail    = errors.New("duplicate email")
+	ErrDuplicateUsername = errors.New("duplicate username")
 )
 
+// UsernameRX matches the usernames ValidateUsername accepts.
+var UsernameRX = regexp.MustCompile(`^[a-zA-Z0-9_](?:[a-zA-Z0-9_.-]*[a-zA-Z0-9_])?$`)
+
 func (m UserModel) Insert(user *User) error {
 	query := `
-		INSERT INTO users (name, email, password_hash, activated)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (name, username, email, password_hash, activated, service_account)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)
 		RETURNING id, created_at, version`
-	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []interface{}{user.Name, user.Username, user.Email, user.Password.hash, user.Activated, user.ServiceAccount}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -94,6 +132,8 @@ func (m UserModel) Insert(user *User) error {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateEmail
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+			return ErrDuplicateUsername
 		default:
 			return err
 		}
@@ -103,7 +143,7 @@ func (m UserModel) Insert(user *User) error {
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, COALESCE(username, ''), email, avatar, password_hash, activated, banned, service_account, deleted_at, anonymized, version
 		FROM users
 		WHERE email = $1`
 	var user User
@@ -113,9 +153,52 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.ID,
 		&user.CreatedAt,
 		&user.Name,
+		&user.Username,
+		&user.Email,
+		&user.Avatar,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Banned,
+		&user.ServiceAccount,
+		&user.DeletedAt,
+		&user.Anonymized,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, name, COALESCE(username, ''), email, avatar, password_hash, activated, banned, service_account, deleted_at, anonymized, version
+		FROM users
+		WHERE id = $1`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Username,
 		&user.Email,
+		&user.Avatar,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Banned,
+		&user.ServiceAccount,
+		&user.DeletedAt,
+		&user.Anonymized,
 		&user.Version,
 	)
 	if err != nil {
@@ -132,16 +215,19 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET name = $1, username = NULLIF($9, ''), email = $2, avatar = $3, password_hash = $4, activated = $5, banned = $6, version = version + 1
+		WHERE id = $7 AND version = $8
 		RETURNING version`
 	args := []interface{}{
 		user.Name,
 		user.Email,
+		user.Avatar,
 		user.Password.hash,
 		user.Activated,
+		user.Banned,
 		user.ID,
 		user.Version,
+		user.Username,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -150,7 +236,95 @@ func (m UserModel) Update(user *User) error {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateEmail
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+			return ErrDuplicateUsername
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAll searches users by name, username or email. A non-nil activated filters them by
+// activation state.
+func (m UserModel) GetAll(search string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, COALESCE(username, ''), email, avatar, activated, banned, service_account, deleted_at, anonymized, version
+		FROM users
+		WHERE (name ILIKE '%%' || $1 || '%%' OR username ILIKE '%%' || $1 || '%%' OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+		AND (activated = $2 OR $2 IS NULL)
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, search, activated, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Username,
+			&user.Email,
+			&user.Avatar,
+			&user.Activated,
+			&user.Banned,
+			&user.ServiceAccount,
+			&user.DeletedAt,
+			&user.Anonymized,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	return users, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// SetPendingEmail stores the address the user asked to change their email to
+// until they confirm it.
+func (m UserModel) SetPendingEmail(userID int64, email string) error {
+	query := `
+		UPDATE users
+		SET pending_email = $2
+		WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, email)
+	return err
+}
 
+// ConfirmEmail switches the user to their pending email address. It returns
+// ErrDuplicateEmail when the address was taken in the meantime, and
+// ErrEditConflict when the user changed or there is no pending address.
+func (m UserModel) ConfirmEmail(user *User) error {
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, version = version + 1
+		WHERE id = $1 AND version = $2 AND pending_email IS NOT NULL
+		RETURNING email, version`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, user.ID, user.Version).Scan(&user.Email, &user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
@@ -159,11 +333,12 @@ func (m UserModel) Update(user *User) error {
 	}
 	return nil
 }
+
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	query := `
-SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+SELECT users.id, users.created_at, users.name, COALESCE(users.username, ''), users.email, users.avatar, users.password_hash, users.activated, users.banned, users.service_account, users.deleted_at, users.anonymized, users.version
 FROM users
 INNER JOIN tokens
 ON users.id = tokens.user_id
@@ -180,9 +355,15 @@ AND tokens.expiry > $3`
 		&user.ID,
 		&user.CreatedAt,
 		&user.Name,
+		&user.Username,
 		&user.Email,
+		&user.Avatar,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Banned,
+		&user.ServiceAccount,
+		&user.DeletedAt,
+		&user.Anonymized,
 		&user.Version,
 	)
 	if err != nil {
@@ -196,6 +377,182 @@ AND tokens.expiry > $3`
 	return &user, nil
 }
 
+// GetForMentions resolves usernames from @mentions to users. Usernames are
+// unique regardless of case, so each resolves to at most one user.
+func (m UserModel) GetForMentions(usernames []string) ([]*User, error) {
+	query := `
+		SELECT id, name, username
+		FROM users
+		WHERE username = ANY($1::citext[])
+		AND deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
+
+// SoftDelete marks the user as deleted and signs them out everywhere, OAuth
+// tokens included. Their API keys and OAuth clients stop working while the
+// user is deleted. The account can still be restored until AnonymizeDeleted
+// gets to it.
+func (m UserModel) SoftDelete(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING deleted_at, version`
+	err = tx.QueryRowContext(ctx, query, user.ID, user.Version).Scan(&user.DeletedAt, &user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	// Deleting the sessions also deletes their tokens.
+	_, err = tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, user.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1`, user.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Restore cancels the deletion of a user that was not anonymized yet.
+func (m UserModel) Restore(user *User) error {
+	query := `
+		UPDATE users
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND version = $2 AND NOT anonymized
+		RETURNING version`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	user.DeletedAt = nil
+	return nil
+}
+
+// anonymizedUserData lists the tables rows of anonymized users are deleted
+// from. Comments are kept and show the anonymized name as their author.
+var anonymizedUserData = []string{
+	`DELETE FROM sessions WHERE user_id = ANY($1)`,
+	`DELETE FROM tokens WHERE user_id = ANY($1)`,
+	`DELETE FROM api_keys WHERE user_id = ANY($1)`,
+	`DELETE FROM oauth_clients WHERE user_id = ANY($1)`,
+	`DELETE FROM totp_recovery_codes WHERE user_id = ANY($1)`,
+	`DELETE FROM user_totp WHERE user_id = ANY($1)`,
+	`DELETE FROM users_permissions WHERE user_id = ANY($1)`,
+	`DELETE FROM users_roles WHERE user_id = ANY($1)`,
+	`DELETE FROM favorite_episodes WHERE user_id = ANY($1)`,
+	`DELETE FROM watched_episodes WHERE user_id = ANY($1)`,
+	`DELETE FROM comment_reactions WHERE user_id = ANY($1)`,
+	`DELETE FROM episode_reactions WHERE user_id = ANY($1)`,
+	`DELETE FROM comment_votes WHERE user_id = ANY($1)`,
+	`DELETE FROM comment_reports WHERE user_id = ANY($1)`,
+	`DELETE FROM notifications WHERE user_id = ANY($1) OR actor_id = ANY($1)`,
+	`DELETE FROM notification_preferences WHERE user_id = ANY($1)`,
+	`DELETE FROM login_failures WHERE email IN (SELECT email FROM users WHERE id = ANY($1))`,
+}
+
+// AnonymizeDeleted strips the personal data of users deleted before the
+// given time and returns how many there were. The user rows stay, under a
+// placeholder name and email, so that their comments keep an author.
+func (m UserModel) AnonymizeDeleted(before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id
+		FROM users
+		WHERE deleted_at < $1 AND NOT anonymized
+		FOR UPDATE SKIP LOCKED`
+	rows, err := tx.QueryContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	for _, query := range anonymizedUserData {
+		_, err = tx.ExecContext(ctx, query, pq.Array(ids))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	query = `
+		UPDATE users
+		SET name = 'deleted user', username = NULL, email = 'deleted-' || id || '@users.invalid', pending_email = NULL, avatar = '',
+			password_hash = '', activated = false, anonymized = true, version = version + 1
+		WHERE id = ANY($1)`
+	_, err = tx.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), tx.Commit()
+}
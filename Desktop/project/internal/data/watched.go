@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type WatchedEpisode struct {
+	EpisodeID int64     `json:"episode_id"`
+	WatchedAt time.Time `json:"watched_at"`
+}
+
+type WatchedModel struct {
+	DB *sql.DB
+}
+
+func (m WatchedModel) Add(userID, episodeID int64) error {
+	query := `
+		INSERT INTO watched_episodes (user_id, episode_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, episodeID)
+	return err
+}
+
+func (m WatchedModel) Remove(userID, episodeID int64) error {
+	query := `
+		DELETE FROM watched_episodes
+		WHERE user_id = $1 AND episode_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, episodeID)
+	return err
+}
+
+func (m WatchedModel) GetAllForUser(userID int64) ([]*WatchedEpisode, error) {
+	query := `
+		SELECT episode_id, watched_at
+		FROM watched_episodes
+		WHERE user_id = $1
+		ORDER BY watched_at DESC, episode_id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watched := []*WatchedEpisode{}
+	for rows.Next() {
+		var episode WatchedEpisode
+		if err := rows.Scan(&episode.EpisodeID, &episode.WatchedAt); err != nil {
+			return nil, err
+		}
+		watched = append(watched, &episode)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return watched, nil
+}
+
+// WatchedAmong reports which of the given episodes the user has watched.
+func (m WatchedModel) WatchedAmong(userID int64, episodeIDs []int64) (map[int64]bool, error) {
+	watched := make(map[int64]bool)
+	if len(episodeIDs) == 0 {
+		return watched, nil
+	}
+
+	query := `
+		SELECT episode_id
+		FROM watched_episodes
+		WHERE user_id = $1 AND episode_id = ANY($2)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(episodeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var episodeID int64
+		if err := rows.Scan(&episodeID); err != nil {
+			return nil, err
+		}
+		watched[episodeID] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return watched, nil
+}
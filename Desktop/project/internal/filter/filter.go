@@ -0,0 +1,87 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action is what a filter wants done with a piece of content. Higher values
+// win when several filters in a Chain disagree.
+type Action int8
+
+const (
+	ActionAllow Action = iota
+	ActionMask
+	ActionFlag
+	ActionReject
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionAllow:
+		return "allow"
+	case ActionMask:
+		return "mask"
+	case ActionFlag:
+		return "flag"
+	case ActionReject:
+		return "reject"
+	default:
+		return ""
+	}
+}
+
+func ParseAction(s string) (Action, error) {
+	switch strings.ToLower(s) {
+	case "allow":
+		return ActionAllow, nil
+	case "mask":
+		return ActionMask, nil
+	case "flag":
+		return ActionFlag, nil
+	case "reject":
+		return ActionReject, nil
+	default:
+		return ActionAllow, fmt.Errorf("invalid filter action %q", s)
+	}
+}
+
+type Content struct {
+	UserID int64
+	Text   string
+}
+
+// Verdict is the outcome of running content through a filter. Text holds the
+// content as it should be stored, which differs from the input only when
+// something was masked.
+type Verdict struct {
+	Action Action
+	Text   string
+	Reason string
+}
+
+type ContentFilter interface {
+	Check(content Content) Verdict
+}
+
+// Chain runs every filter in order. Masked text from one filter is passed on
+// to the next, and the strictest action is returned.
+type Chain []ContentFilter
+
+func (c Chain) Check(content Content) Verdict {
+	result := Verdict{Action: ActionAllow, Text: content.Text}
+	for _, f := range c {
+		verdict := f.Check(Content{UserID: content.UserID, Text: result.Text})
+		if verdict.Action == ActionMask {
+			result.Text = verdict.Text
+		}
+		if verdict.Action > result.Action {
+			result.Action = verdict.Action
+			result.Reason = verdict.Reason
+		}
+		if result.Action == ActionReject {
+			break
+		}
+	}
+	return result
+}
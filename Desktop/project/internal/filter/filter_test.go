@@ -0,0 +1,179 @@
+package filter
+
+import (
+	"testing"
+	"time"
+)
+
+// stubFilter returns a fixed action and, when masking, a fixed text.
+type stubFilter struct {
+	action Action
+	text   string
+	reason string
+	seen   *string
+}
+
+func (f stubFilter) Check(content Content) Verdict {
+	if f.seen != nil {
+		*f.seen = content.Text
+	}
+	text := content.Text
+	if f.action == ActionMask {
+		text = f.text
+	}
+	return Verdict{Action: f.action, Text: text, Reason: f.reason}
+}
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Action
+		wantErr bool
+	}{
+		{"allow", ActionAllow, false},
+		{"mask", ActionMask, false},
+		{"FLAG", ActionFlag, false},
+		{"Reject", ActionReject, false},
+		{"", ActionAllow, true},
+		{"block", ActionAllow, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseAction(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAction(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAction(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+			if !tt.wantErr && got.String() != tt.want.String() {
+				t.Errorf("String() = %q", got.String())
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var seen string
+	tests := []struct {
+		name       string
+		chain      Chain
+		wantAction Action
+		wantText   string
+		wantReason string
+	}{
+		{"empty", Chain{}, ActionAllow, "text", ""},
+		{"all allow", Chain{stubFilter{action: ActionAllow}, stubFilter{action: ActionAllow}}, ActionAllow, "text", ""},
+		{"strictest wins", Chain{
+			stubFilter{action: ActionFlag, reason: "flag"},
+			stubFilter{action: ActionMask, text: "t**t", reason: "mask"},
+		}, ActionFlag, "t**t", "flag"},
+		{"masks accumulate", Chain{
+			stubFilter{action: ActionMask, text: "masked", reason: "first"},
+			stubFilter{action: ActionMask, text: "masked twice", reason: "second"},
+		}, ActionMask, "masked twice", "first"},
+		{"reject stops", Chain{
+			stubFilter{action: ActionReject, reason: "reject"},
+			stubFilter{action: ActionMask, text: "never", reason: "mask"},
+		}, ActionReject, "text", "reject"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.chain.Check(Content{UserID: 1, Text: "text"})
+			if got.Action != tt.wantAction || got.Text != tt.wantText || got.Reason != tt.wantReason {
+				t.Errorf("Check = %+v, want {%v %q %q}", got, tt.wantAction, tt.wantText, tt.wantReason)
+			}
+		})
+	}
+
+	t.Run("masked text is passed on", func(t *testing.T) {
+		chain := Chain{stubFilter{action: ActionMask, text: "masked"}, stubFilter{action: ActionAllow, seen: &seen}}
+		chain.Check(Content{Text: "text"})
+		if seen != "masked" {
+			t.Errorf("second filter saw %q, want %q", seen, "masked")
+		}
+	})
+}
+
+func TestLinkFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		max        int
+		action     Action
+		text       string
+		wantAction Action
+		wantText   string
+	}{
+		{"under the limit", 1, ActionReject, "see https://example.com", ActionAllow, "see https://example.com"},
+		{"over the limit", 1, ActionReject, "https://a.com and www.b.com", ActionReject, "https://a.com and www.b.com"},
+		{"no links allowed", 0, ActionFlag, "HTTP://EXAMPLE.COM", ActionFlag, "HTTP://EXAMPLE.COM"},
+		{"masked", 0, ActionMask, "go to http://a.com/x?y=1 or www.b.com.", ActionMask, "go to [link removed] or [link removed]"},
+		{"not a link", 0, ActionReject, "example.com is fine", ActionAllow, "example.com is fine"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewLinkFilter(tt.max, tt.action).Check(Content{Text: tt.text})
+			if got.Action != tt.wantAction || got.Text != tt.wantText {
+				t.Errorf("Check = {%v %q}, want {%v %q}", got.Action, got.Text, tt.wantAction, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestFloodFilter(t *testing.T) {
+	type post struct {
+		userID int64
+		text   string
+		want   Action
+	}
+	tests := []struct {
+		name            string
+		max             int
+		duplicateAction Action
+		floodAction     Action
+		posts           []post
+	}{
+		{"duplicate", 10, ActionReject, ActionReject, []post{
+			{1, "Hello  World", ActionAllow},
+			{1, "hello world", ActionReject},
+			{2, "hello world", ActionAllow},
+		}},
+		{"flood", 2, ActionAllow, ActionReject, []post{
+			{1, "one", ActionAllow},
+			{1, "two", ActionAllow},
+			{1, "three", ActionReject},
+			{2, "four", ActionAllow},
+		}},
+		{"duplicate before flood", 1, ActionFlag, ActionReject, []post{
+			{1, "one", ActionAllow},
+			{1, "one", ActionFlag},
+		}},
+		{"allow disables a check", 1, ActionAllow, ActionAllow, []post{
+			{1, "one", ActionAllow},
+			{1, "one", ActionAllow},
+		}},
+		{"mask means flag", 1, ActionMask, ActionMask, []post{
+			{1, "one", ActionAllow},
+			{1, "one", ActionFlag},
+			{1, "two", ActionFlag},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFloodFilter(time.Hour, tt.max, tt.duplicateAction, tt.floodAction)
+			for i, p := range tt.posts {
+				got := f.Check(Content{UserID: p.userID, Text: p.text})
+				if got.Action != p.want {
+					t.Errorf("post %d: action = %v, want %v", i, got.Action, p.want)
+				}
+				if got.Text != p.text {
+					t.Errorf("post %d: text = %q, want it unchanged", i, got.Text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package filter
+
+import (
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+)
+
+type post struct {
+	hash [sha256.Size]byte
+	at   time.Time
+}
+
+// FloodFilter remembers what each user posted within a sliding window. Posting
+// the same text twice in the window triggers duplicateAction; posting more
+// than max times in the window triggers floodAction. Masking makes no sense
+// here, so a mask action is treated as flag.
+type FloodFilter struct {
+	window          time.Duration
+	max             int
+	duplicateAction Action
+	floodAction     Action
+
+	mu    sync.Mutex
+	posts map[int64][]post
+}
+
+func NewFloodFilter(window time.Duration, max int, duplicateAction, floodAction Action) *FloodFilter {
+	if duplicateAction == ActionMask {
+		duplicateAction = ActionFlag
+	}
+	if floodAction == ActionMask {
+		floodAction = ActionFlag
+	}
+	f := &FloodFilter{
+		window:          window,
+		max:             max,
+		duplicateAction: duplicateAction,
+		floodAction:     floodAction,
+		posts:           make(map[int64][]post),
+	}
+	go f.cleanup()
+	return f
+}
+
+func (f *FloodFilter) cleanup() {
+	for {
+		time.Sleep(f.window)
+		f.mu.Lock()
+		for userID, posts := range f.posts {
+			if len(posts) == 0 || time.Since(posts[len(posts)-1].at) > f.window {
+				delete(f.posts, userID)
+			}
+		}
+		f.mu.Unlock()
+	}
+}
+
+func (f *FloodFilter) Check(content Content) Verdict {
+	normalized := strings.ToLower(strings.Join(strings.Fields(content.Text), " "))
+	current := post{hash: sha256.Sum256([]byte(normalized)), at: time.Now()}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var recent []post
+	duplicate := false
+	for _, p := range f.posts[content.UserID] {
+		if current.at.Sub(p.at) > f.window {
+			continue
+		}
+		if p.hash == current.hash {
+			duplicate = true
+		}
+		recent = append(recent, p)
+	}
+	f.posts[content.UserID] = append(recent, current)
+
+	switch {
+	case duplicate && f.duplicateAction != ActionAllow:
+		return Verdict{Action: f.duplicateAction, Text: content.Text, Reason: "duplicates a recent comment"}
+	case len(recent) >= f.max && f.floodAction != ActionAllow:
+		return Verdict{Action: f.floodAction, Text: content.Text, Reason: "too many comments in a short time"}
+	default:
+		return Verdict{Action: ActionAllow, Text: content.Text}
+	}
+}
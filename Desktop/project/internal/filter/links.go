@@ -0,0 +1,36 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var linkRX = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>()]+`)
+
+// LinkFilter limits the number of links a single piece of content may carry.
+// Masking replaces every link with "[link removed]".
+type LinkFilter struct {
+	max    int
+	action Action
+}
+
+func NewLinkFilter(max int, action Action) *LinkFilter {
+	return &LinkFilter{max: max, action: action}
+}
+
+func (f *LinkFilter) Check(content Content) Verdict {
+	links := linkRX.FindAllStringIndex(content.Text, -1)
+	if len(links) <= f.max {
+		return Verdict{Action: ActionAllow, Text: content.Text}
+	}
+
+	verdict := Verdict{
+		Action: f.action,
+		Text:   content.Text,
+		Reason: fmt.Sprintf("must not contain more than %d links", f.max),
+	}
+	if f.action == ActionMask {
+		verdict.Text = linkRX.ReplaceAllString(content.Text, "[link removed]")
+	}
+	return verdict
+}
@@ -0,0 +1,157 @@
+package filter
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WordListFilter matches whole words from a list loaded from a local file,
+// one word per line. Blank lines and lines starting with # are ignored.
+type WordListFilter struct {
+	path    string
+	action  Action
+	mu      sync.RWMutex
+	rx      *regexp.Regexp
+	modTime time.Time
+}
+
+func NewWordListFilter(path string, action Action) (*WordListFilter, error) {
+	f := &WordListFilter{path: path, action: action}
+	err := f.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *WordListFilter) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words = append(words, regexp.QuoteMeta(strings.ToLower(word)))
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	// Word boundaries are checked by findWords, as \b only knows ASCII
+	// letters and never matches next to a word starting or ending with a
+	// symbol. Longer words go first so that they win over their prefixes.
+	sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+	var rx *regexp.Regexp
+	if len(words) > 0 {
+		rx, err = regexp.Compile(`(?i)(?:` + strings.Join(words, "|") + `)`)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	f.rx = rx
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the word list whenever the file's modification time changes.
+// It blocks, so callers should run it in its own goroutine.
+func (f *WordListFilter) Watch(interval time.Duration, onError func(error)) {
+	for {
+		time.Sleep(interval)
+
+		info, err := os.Stat(f.path)
+		if err != nil {
+			onError(err)
+			continue
+		}
+
+		f.mu.RLock()
+		changed := !info.ModTime().Equal(f.modTime)
+		f.mu.RUnlock()
+
+		if changed {
+			if err := f.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (f *WordListFilter) Check(content Content) Verdict {
+	f.mu.RLock()
+	rx := f.rx
+	f.mu.RUnlock()
+
+	var matches [][2]int
+	if rx != nil {
+		matches = findWords(rx, content.Text)
+	}
+	if len(matches) == 0 {
+		return Verdict{Action: ActionAllow, Text: content.Text}
+	}
+
+	verdict := Verdict{Action: f.action, Text: content.Text, Reason: "contains disallowed language"}
+	if f.action == ActionMask {
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			b.WriteString(content.Text[last:m[0]])
+			b.WriteString(strings.Repeat("*", utf8.RuneCountInString(content.Text[m[0]:m[1]])))
+			last = m[1]
+		}
+		b.WriteString(content.Text[last:])
+		verdict.Text = b.String()
+	}
+	return verdict
+}
+
+// findWords returns the byte ranges of the matches of rx in text that are
+// whole words: neither preceded nor followed by a letter, digit or underscore
+// of any script.
+func findWords(rx *regexp.Regexp, text string) [][2]int {
+	var matches [][2]int
+	for start := 0; start < len(text); {
+		loc := rx.FindStringIndex(text[start:])
+		if loc == nil {
+			break
+		}
+		i, j := start+loc[0], start+loc[1]
+
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[j:])
+		if !isWordRune(before) && !isWordRune(after) {
+			matches = append(matches, [2]int{i, j})
+			start = j
+			continue
+		}
+		// A shorter word may still match inside this one.
+		_, size := utf8.DecodeRuneInString(text[i:])
+		start = i + size
+	}
+	return matches
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
@@ -0,0 +1,108 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestWordList(t *testing.T, action Action, list string) *WordListFilter {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "words.txt")
+	err := os.WriteFile(path, []byte(list), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewWordListFilter(path, action)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestWordListFilter(t *testing.T) {
+	const list = `
+# comments and blank lines are skipped
+bad
+badword
+жаман
+a$$
+`
+	tests := []struct {
+		name       string
+		text       string
+		wantAction Action
+		wantText   string
+	}{
+		{"clean", "a good comment", ActionAllow, "a good comment"},
+		{"whole word", "that was bad.", ActionMask, "that was ***."},
+		{"case insensitive", "BAD ending", ActionMask, "*** ending"},
+		{"inside a word", "badminton and abad", ActionAllow, "badminton and abad"},
+		{"next to a digit", "bad1 _bad", ActionAllow, "bad1 _bad"},
+		{"longest first", "a badword here", ActionMask, "a ******* here"},
+		{"symbols", "you a$$!", ActionMask, "you ***!"},
+		{"Cyrillic", "Бұл ЖАМАН сөз", ActionMask, "Бұл ***** сөз"},
+		{"inside a Cyrillic word", "жамандық", ActionAllow, "жамандық"},
+		{"comment line is not a word", "comments and blank", ActionAllow, "comments and blank"},
+		{"several", "bad, bad жаман", ActionMask, "***, *** *****"},
+	}
+
+	f := newTestWordList(t, ActionMask, list)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := f.Check(Content{Text: tt.text})
+			if got.Action != tt.wantAction || got.Text != tt.wantText {
+				t.Errorf("Check(%q) = {%v %q}, want {%v %q}", tt.text, got.Action, got.Text, tt.wantAction, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestWordListFilterActions(t *testing.T) {
+	tests := []struct {
+		name   string
+		list   string
+		action Action
+		want   Action
+	}{
+		{"reject", "bad\n", ActionReject, ActionReject},
+		{"flag", "bad\n", ActionFlag, ActionFlag},
+		{"empty list", "# nothing\n\n", ActionReject, ActionAllow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestWordList(t, tt.action, tt.list)
+			got := f.Check(Content{Text: "so bad"})
+			if got.Action != tt.want || got.Text != "so bad" {
+				t.Errorf("Check = {%v %q}, want {%v %q}", got.Action, got.Text, tt.want, "so bad")
+			}
+		})
+	}
+}
+
+func TestWordListFilterReload(t *testing.T) {
+	f := newTestWordList(t, ActionReject, "bad\n")
+
+	err := os.WriteFile(f.path, []byte("worse\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := f.Check(Content{Text: "bad"}); got.Action != ActionAllow {
+		t.Errorf("removed word: action = %v, want %v", got.Action, ActionAllow)
+	}
+	if got := f.Check(Content{Text: "worse"}); got.Action != ActionReject {
+		t.Errorf("added word: action = %v, want %v", got.Action, ActionReject)
+	}
+}
+
+func TestNewWordListFilterMissingFile(t *testing.T) {
+	_, err := NewWordListFilter(filepath.Join(t.TempDir(), "missing.txt"), ActionReject)
+	if err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,110 @@
+// Package jobs runs background tasks, such as sending emails, on a bounded
+// pool of workers fed from a queue.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"series.bekarysrymkhanov.net/internal/jsonlog"
+)
+
+var (
+	ErrQueueFull = errors.New("jobs: queue is full")
+	ErrClosed    = errors.New("jobs: runner is shut down")
+)
+
+type task struct {
+	name string
+	fn   func()
+}
+
+// Runner executes submitted tasks on a fixed number of workers. A task that
+// panics is logged and does not take its worker down.
+type Runner struct {
+	logger  *jsonlog.Logger
+	queue   chan task
+	workers sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New starts a Runner with the given number of workers and room for
+// queueSize tasks waiting for a worker.
+func New(logger *jsonlog.Logger, workers, queueSize int) *Runner {
+	r := &Runner{
+		logger: logger,
+		queue:  make(chan task, queueSize),
+	}
+
+	for i := 0; i < max(workers, 1); i++ {
+		r.workers.Add(1)
+		go r.work()
+	}
+	return r
+}
+
+// Submit queues fn to run in the background. It never blocks: when the queue
+// is full it returns ErrQueueFull, and after Shutdown it returns ErrClosed.
+func (r *Runner) Submit(name string, fn func()) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+
+	select {
+	case r.queue <- task{name: name, fn: fn}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting tasks and waits for the queued and running ones to
+// finish, or for ctx to be done, whichever comes first.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("jobs: %d tasks still queued: %w", len(r.queue), ctx.Err())
+	}
+}
+
+func (r *Runner) work() {
+	defer r.workers.Done()
+
+	for t := range r.queue {
+		r.run(t)
+	}
+}
+
+func (r *Runner) run(t task) {
+	defer func() {
+		if err := recover(); err != nil {
+			r.logger.PrintError(fmt.Errorf("%s", err), map[string]string{
+				"task": t.name,
+			})
+		}
+	}()
+
+	t.fn()
+}
@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"series.bekarysrymkhanov.net/internal/jsonlog"
+)
+
+// syncBuffer lets the test read what workers log.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newRunner(workers, queueSize int) (*Runner, *syncBuffer) {
+	var out syncBuffer
+	return New(jsonlog.New(&out, jsonlog.LevelInfo), workers, queueSize), &out
+}
+
+func TestShutdownDrainsQueue(t *testing.T) {
+	r, _ := newRunner(2, 100)
+
+	var ran atomic.Int64
+	for i := 0; i < 50; i++ {
+		err := r.Submit("count", func() {
+			time.Sleep(time.Millisecond)
+			ran.Add(1)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := r.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ran.Load(); got != 50 {
+		t.Errorf("%d tasks ran, want 50", got)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup leaves the runner in the state Submit is tried in.
+		setup func(t *testing.T, r *Runner, release chan struct{})
+		want  error
+	}{
+		{"room in the queue", func(t *testing.T, r *Runner, release chan struct{}) {}, nil},
+		{"queue full", func(t *testing.T, r *Runner, release chan struct{}) {
+			started := make(chan struct{})
+			r.Submit("block", func() {
+				close(started)
+				<-release
+			})
+			<-started
+			if err := r.Submit("wait", func() {}); err != nil {
+				t.Fatal(err)
+			}
+		}, ErrQueueFull},
+		{"after shutdown", func(t *testing.T, r *Runner, release chan struct{}) {
+			if err := r.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}, ErrClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newRunner(1, 1)
+			release := make(chan struct{})
+			tt.setup(t, r, release)
+
+			err := r.Submit("task", func() {})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Submit error = %v, want %v", err, tt.want)
+			}
+
+			close(release)
+			if err := r.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestPanickingTask(t *testing.T) {
+	r, out := newRunner(1, 10)
+
+	ran := false
+	r.Submit("explode", func() { panic("boom") })
+	r.Submit("after", func() { ran = true })
+
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Error("the worker did not survive a panicking task")
+	}
+	if log := out.String(); !strings.Contains(log, "boom") || !strings.Contains(log, "explode") {
+		t.Errorf("panic was not logged with its task: %q", log)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	r, _ := newRunner(1, 10)
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	r.Submit("block", func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := r.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
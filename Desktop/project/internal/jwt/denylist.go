@@ -0,0 +1,95 @@
+package jwt
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Denylist revokes signed tokens before they expire. A token is revoked when
+// its ID or session was revoked, or when its subject was revoked in a later
+// second than the one it was issued in. Tokens carry their issue time in whole
+// seconds, so one issued to the subject in the same second as a revocation is
+// kept: it is more likely to come from a login right after the revocation than
+// from just before it. IDs and sessions are never issued again, so they need
+// no such grace. Entries only need to outlive the longest token lifetime, so
+// they are dropped after ttl and the list stays small.
+//
+// The list lives in memory. Revocations reach other API instances only when
+// they are published with OnRevoke and applied there with Add, as
+// ListenRevoked does.
+type Denylist struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]int64
+	onRevoke func(key string, revokedAt int64)
+}
+
+func NewDenylist(ttl time.Duration) *Denylist {
+	return &Denylist{ttl: ttl, entries: make(map[string]int64)}
+}
+
+// OnRevoke sets a function called with every revocation made through d, for
+// sharing it with other instances.
+func (d *Denylist) OnRevoke(fn func(key string, revokedAt int64)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onRevoke = fn
+}
+
+func (d *Denylist) RevokeToken(claims *Claims) {
+	d.revoke("jti:" + claims.ID)
+}
+
+func (d *Denylist) RevokeSession(sessionID int64) {
+	d.revoke("sid:" + strconv.FormatInt(sessionID, 10))
+}
+
+// RevokeSubject revokes every token issued to the user so far.
+func (d *Denylist) RevokeSubject(userID int64) {
+	d.revoke("sub:" + strconv.FormatInt(userID, 10))
+}
+
+func (d *Denylist) Revoked(claims *Claims) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.entries["jti:"+claims.ID]; ok {
+		return true
+	}
+	if _, ok := d.entries["sid:"+strconv.FormatInt(claims.SessionID, 10)]; ok {
+		return true
+	}
+	revokedAt, ok := d.entries["sub:"+strconv.FormatInt(claims.Subject, 10)]
+	return ok && claims.IssuedAt < revokedAt
+}
+
+func (d *Denylist) revoke(key string) {
+	revokedAt := time.Now().Unix()
+	d.Add(key, revokedAt)
+
+	d.mu.Lock()
+	onRevoke := d.onRevoke
+	d.mu.Unlock()
+	if onRevoke != nil {
+		onRevoke(key, revokedAt)
+	}
+}
+
+// Add records a revocation made by another instance, keyed as the ones
+// passed to OnRevoke.
+func (d *Denylist) Add(key string, revokedAt int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for k, at := range d.entries {
+		if now.Sub(time.Unix(at, 0)) > d.ttl {
+			delete(d.entries, k)
+		}
+	}
+	if revokedAt > d.entries[key] {
+		d.entries[key] = revokedAt
+	}
+}
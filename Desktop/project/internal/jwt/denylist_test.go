@@ -0,0 +1,84 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDenylist(t *testing.T) {
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name   string
+		revoke func(d *Denylist)
+		claims Claims
+		want   bool
+	}{
+		{"nothing revoked", func(d *Denylist) {}, Claims{ID: "a", SessionID: 1, Subject: 1, IssuedAt: now - 1}, false},
+		{"token issued before", func(d *Denylist) { d.RevokeToken(&Claims{ID: "a"}) }, Claims{ID: "a", IssuedAt: now - 1}, true},
+		{"other token", func(d *Denylist) { d.RevokeToken(&Claims{ID: "a"}) }, Claims{ID: "b", IssuedAt: now - 1}, false},
+		// IDs and sessions are never reused, so a logout in the same second
+		// as the login still counts.
+		{"token issued in the same second", func(d *Denylist) { d.RevokeToken(&Claims{ID: "a"}) }, Claims{ID: "a", IssuedAt: time.Now().Unix()}, true},
+		{"session issued before", func(d *Denylist) { d.RevokeSession(1) }, Claims{SessionID: 1, IssuedAt: now - 1}, true},
+		{"session issued in the same second", func(d *Denylist) { d.RevokeSession(1) }, Claims{SessionID: 1, IssuedAt: time.Now().Unix()}, true},
+		{"session added in the same second", func(d *Denylist) { d.Add("sid:1", now) }, Claims{SessionID: 1, IssuedAt: now}, true},
+		{"other session", func(d *Denylist) { d.RevokeSession(1) }, Claims{SessionID: 2, IssuedAt: now - 1}, false},
+		{"subject issued before", func(d *Denylist) { d.RevokeSubject(1) }, Claims{Subject: 1, IssuedAt: now - 60}, true},
+		{"subject issued after", func(d *Denylist) { d.RevokeSubject(1) }, Claims{Subject: 1, IssuedAt: now + 1}, false},
+		// A login right after a revocation gets a token stamped with the
+		// same second, which must keep working.
+		{"subject issued in the same second", func(d *Denylist) { d.Add("sub:1", now) }, Claims{Subject: 1, IssuedAt: now}, false},
+		{"added by another instance", func(d *Denylist) { d.Add("sub:1", now) }, Claims{Subject: 1, IssuedAt: now - 1}, true},
+		{"earlier revocation added later", func(d *Denylist) {
+			d.Add("sub:1", now)
+			d.Add("sub:1", now-10)
+		}, Claims{Subject: 1, IssuedAt: now - 5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDenylist(time.Hour)
+			tt.revoke(d)
+			if got := d.Revoked(&tt.claims); got != tt.want {
+				t.Errorf("Revoked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenylistOnRevoke(t *testing.T) {
+	d := NewDenylist(time.Hour)
+
+	var keys []string
+	d.OnRevoke(func(key string, revokedAt int64) {
+		keys = append(keys, key)
+	})
+	d.RevokeToken(&Claims{ID: "a"})
+	d.RevokeSession(2)
+	d.RevokeSubject(3)
+	d.Add("sub:4", time.Now().Unix())
+
+	want := []string{"jti:a", "sid:2", "sub:3"}
+	if len(keys) != len(want) {
+		t.Fatalf("published %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("published %v, want %v", keys, want)
+		}
+	}
+}
+
+func TestDenylistExpiry(t *testing.T) {
+	d := NewDenylist(time.Minute)
+	d.Add("sub:1", time.Now().Add(-2*time.Minute).Unix())
+	d.Add("sub:2", time.Now().Unix())
+
+	if _, ok := d.entries["sub:1"]; ok {
+		t.Error("entry older than the ttl was kept")
+	}
+	if _, ok := d.entries["sub:2"]; !ok {
+		t.Error("fresh entry was dropped")
+	}
+}
@@ -0,0 +1,222 @@
+// Package jwt issues and verifies the signed access tokens used when the API
+// runs in stateless token mode. Only the compact JWS serialization with HS256
+// or EdDSA (Ed25519) signatures is supported.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("jwt: invalid token")
+	ErrExpired      = errors.New("jwt: token expired")
+	ErrUnknownKey   = errors.New("jwt: unknown signing key")
+)
+
+var encoding = base64.RawURLEncoding
+
+// Claims is the payload of an access token.
+type Claims struct {
+	Issuer      string   `json:"iss"`
+	Subject     int64    `json:"sub,string"`
+	ID          string   `json:"jti"`
+	SessionID   int64    `json:"sid,omitempty"`
+	IssuedAt    int64    `json:"iat"`
+	ExpiresAt   int64    `json:"exp"`
+	Name        string   `json:"name"`
+	Picture     string   `json:"picture,omitempty"`
+	Activated   bool     `json:"activated"`
+	Banned      bool     `json:"banned,omitempty"`
+	TwoFactor   bool     `json:"2fa,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Keyring holds every key tokens may be verified with and the one new tokens
+// are signed with. Rotating keys means adding the new key, switching the
+// signing key to it, and dropping the old key once its tokens have expired.
+type Keyring struct {
+	issuer  string
+	signing *Key
+	keys    map[string]*Key
+}
+
+func NewKeyring(issuer, signingKeyID string, keys ...*Key) (*Keyring, error) {
+	kr := &Keyring{issuer: issuer, keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, exists := kr.keys[key.ID]; exists {
+			return nil, fmt.Errorf("jwt: duplicate key id %q", key.ID)
+		}
+		kr.keys[key.ID] = key
+	}
+
+	kr.signing = kr.keys[signingKeyID]
+	if kr.signing == nil {
+		return nil, fmt.Errorf("jwt: signing key %q is not configured", signingKeyID)
+	}
+	if !kr.signing.canSign() {
+		return nil, fmt.Errorf("jwt: key %q has no private part to sign with", signingKeyID)
+	}
+	return kr, nil
+}
+
+// Sign fills in the issuer and returns the signed token.
+func (kr *Keyring) Sign(claims *Claims) (string, error) {
+	claims.Issuer = kr.issuer
+
+	h, err := json.Marshal(header{Algorithm: kr.signing.Algorithm, Type: "JWT", KeyID: kr.signing.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encoding.EncodeToString(h) + "." + encoding.EncodeToString(payload)
+	return signingInput + "." + encoding.EncodeToString(kr.signing.sign([]byte(signingInput))), nil
+}
+
+// Verify checks the signature, issuer and expiry of a token and returns its
+// claims.
+func (kr *Keyring) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	rawHeader, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	key := kr.keys[h.KeyID]
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+	// The algorithm is fixed by the key, never chosen by the token.
+	if h.Algorithm != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	rawClaims, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Issuer != kr.issuer {
+		return nil, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+// LooksLikeJWT reports whether token has the shape of a compact JWS, which
+// tells it apart from the opaque tokens.
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Key is a named signing key.
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	private   ed25519.PrivateKey
+	public    ed25519.PublicKey
+}
+
+// ParseKey parses a key given as "kid:alg:material", where material is
+// base64. HS256 keys take a secret of at least 32 bytes. EdDSA keys take
+// either a 32-byte seed, which can sign, or a 32-byte public key prefixed
+// with "pub=", which can only verify.
+func ParseKey(spec string) (*Key, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, fmt.Errorf("jwt: key must be given as kid:alg:material")
+	}
+	key := &Key{ID: parts[0], Algorithm: parts[1]}
+
+	material, public := strings.CutPrefix(parts[2], "pub=")
+	raw, err := base64.StdEncoding.DecodeString(material)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: key %q: %w", key.ID, err)
+	}
+
+	switch key.Algorithm {
+	case AlgorithmHS256:
+		if public {
+			return nil, fmt.Errorf("jwt: key %q: HS256 keys have no public part", key.ID)
+		}
+		if len(raw) < 32 {
+			return nil, fmt.Errorf("jwt: key %q: HS256 secrets must be at least 32 bytes", key.ID)
+		}
+		key.secret = raw
+	case AlgorithmEdDSA:
+		switch {
+		case public && len(raw) == ed25519.PublicKeySize:
+			key.public = ed25519.PublicKey(raw)
+		case !public && len(raw) == ed25519.SeedSize:
+			key.private = ed25519.NewKeyFromSeed(raw)
+			key.public = key.private.Public().(ed25519.PublicKey)
+		default:
+			return nil, fmt.Errorf("jwt: key %q: EdDSA keys must be 32 bytes", key.ID)
+		}
+	default:
+		return nil, fmt.Errorf("jwt: key %q: unsupported algorithm %q", key.ID, key.Algorithm)
+	}
+	return key, nil
+}
+
+func (k *Key) canSign() bool {
+	return k.secret != nil || k.private != nil
+}
+
+func (k *Key) sign(input []byte) []byte {
+	if k.Algorithm == AlgorithmEdDSA {
+		return ed25519.Sign(k.private, input)
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(input)
+	return mac.Sum(nil)
+}
+
+func (k *Key) verify(input, signature []byte) bool {
+	if k.Algorithm == AlgorithmEdDSA {
+		return ed25519.Verify(k.public, input, signature)
+	}
+	return hmac.Equal(k.sign(input), signature)
+}
@@ -0,0 +1,213 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIssuer = "series.test"
+
+var (
+	hsSpec = "hs:HS256:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("s", 32)))
+	edSeed = []byte(strings.Repeat("e", ed25519.SeedSize))
+	edSpec = "ed:EdDSA:" + base64.StdEncoding.EncodeToString(edSeed)
+)
+
+func mustKey(t *testing.T, spec string) *Key {
+	t.Helper()
+	key, err := ParseKey(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func mustKeyring(t *testing.T, issuer, signing string, specs ...string) *Keyring {
+	t.Helper()
+	var keys []*Key
+	for _, spec := range specs {
+		keys = append(keys, mustKey(t, spec))
+	}
+	kr, err := NewKeyring(issuer, signing, keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+// craft assembles a token from a raw header and claims, signed with sign.
+func craft(t *testing.T, h header, claims Claims, sign func(input []byte) []byte) string {
+	t.Helper()
+	rawHeader, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawClaims, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := encoding.EncodeToString(rawHeader) + "." + encoding.EncodeToString(rawClaims)
+	return input + "." + encoding.EncodeToString(sign([]byte(input)))
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	for _, signing := range []string{"hs", "ed"} {
+		t.Run(signing, func(t *testing.T) {
+			kr := mustKeyring(t, testIssuer, signing, hsSpec, edSpec)
+			claims := &Claims{Subject: 42, ID: "abc", SessionID: 7, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix(), Permissions: []string{"episodes:read"}}
+
+			token, err := kr.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !LooksLikeJWT(token) {
+				t.Errorf("LooksLikeJWT(%q) = false", token)
+			}
+
+			got, err := kr.Verify(token, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Subject != 42 || got.ID != "abc" || got.SessionID != 7 || got.Issuer != testIssuer || len(got.Permissions) != 1 {
+				t.Errorf("Verify returned %+v", got)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	kr := mustKeyring(t, testIssuer, "hs", hsSpec, edSpec, "pub:EdDSA:pub="+base64.StdEncoding.EncodeToString(ed25519.NewKeyFromSeed(edSeed).Public().(ed25519.PublicKey)))
+	hs := kr.keys["hs"]
+	ed := kr.keys["ed"]
+	valid := Claims{Issuer: testIssuer, Subject: 1, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+
+	signed, err := kr.Sign(&Claims{Subject: 1, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(signed, ".")
+
+	expired := valid
+	expired.ExpiresAt = now.Unix()
+	otherIssuer := valid
+	otherIssuer.Issuer = "someone.else"
+	tampered := valid
+	tampered.Subject = 2
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"expired", craft(t, header{AlgorithmHS256, "JWT", "hs"}, expired, hs.sign), ErrExpired},
+		{"other issuer", craft(t, header{AlgorithmHS256, "JWT", "hs"}, otherIssuer, hs.sign), ErrInvalidToken},
+		{"unknown key", craft(t, header{AlgorithmHS256, "JWT", "nope"}, valid, hs.sign), ErrUnknownKey},
+		{"alg none", craft(t, header{"none", "JWT", "hs"}, valid, func([]byte) []byte { return nil }), ErrInvalidToken},
+		// HMAC keyed with the public key of an EdDSA key, the classic
+		// algorithm confusion attack.
+		{"HS256 with an EdDSA key", craft(t, header{AlgorithmHS256, "JWT", "pub"}, valid, func(input []byte) []byte {
+			mac := hmac.New(sha256.New, ed.public)
+			mac.Write(input)
+			return mac.Sum(nil)
+		}), ErrInvalidToken},
+		{"EdDSA header on an HS256 key", craft(t, header{AlgorithmEdDSA, "JWT", "hs"}, valid, ed.sign), ErrInvalidToken},
+		{"signed by another key", craft(t, header{AlgorithmHS256, "JWT", "hs"}, valid, mustKey(t, "hs:HS256:"+base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 32)))).sign), ErrInvalidToken},
+		{"tampered claims", parts[0] + "." + craftClaims(t, tampered) + "." + parts[2], ErrInvalidToken},
+		{"missing signature", parts[0] + "." + parts[1] + ".", ErrInvalidToken},
+		{"two parts", parts[0] + "." + parts[1], ErrInvalidToken},
+		{"bad header encoding", "!!." + parts[1] + "." + parts[2], ErrInvalidToken},
+		{"opaque token", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := kr.Verify(tt.token, now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func craftClaims(t *testing.T, claims Claims) string {
+	t.Helper()
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoding.EncodeToString(raw)
+}
+
+func TestParseKey(t *testing.T) {
+	b64 := func(n int) string { return base64.StdEncoding.EncodeToString(make([]byte, n)) }
+
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+		canSign bool
+	}{
+		{"HS256", "k:HS256:" + b64(32), false, true},
+		{"short HS256 secret", "k:HS256:" + b64(31), true, false},
+		{"HS256 public key", "k:HS256:pub=" + b64(32), true, false},
+		{"EdDSA seed", "k:EdDSA:" + b64(32), false, true},
+		{"EdDSA public key", "k:EdDSA:pub=" + b64(32), false, false},
+		{"short EdDSA seed", "k:EdDSA:" + b64(31), true, false},
+		{"unsupported algorithm", "k:RS256:" + b64(32), true, false},
+		{"alg none", "k:none:" + b64(32), true, false},
+		{"missing kid", ":HS256:" + b64(32), true, false},
+		{"missing material", "k:HS256", true, false},
+		{"bad base64", "k:HS256:***", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKey(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKey error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && key.canSign() != tt.canSign {
+				t.Errorf("canSign = %v, want %v", key.canSign(), tt.canSign)
+			}
+		})
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	pub := "pub:EdDSA:pub=" + base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	tests := []struct {
+		name    string
+		signing string
+		specs   []string
+		wantErr bool
+	}{
+		{"signing key present", "hs", []string{hsSpec, edSpec}, false},
+		{"signing key missing", "other", []string{hsSpec}, true},
+		{"signing key public only", "pub", []string{pub}, true},
+		{"duplicate key id", "hs", []string{hsSpec, hsSpec}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []*Key
+			for _, spec := range tt.specs {
+				keys = append(keys, mustKey(t, spec))
+			}
+			_, err := NewKeyring(testIssuer, tt.signing, keys...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewKeyring error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package jwt
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"series.bekarysrymkhanov.net/internal/jsonlog"
+)
+
+// RevokedChannel is the Postgres notification channel revocations are sent
+// on. The payload is the denylist key and the Unix time of the revocation.
+const RevokedChannel = "jwt_revoked"
+
+// NotifyRevoked sends a revocation made on this instance to every instance
+// listening on RevokedChannel.
+func NotifyRevoked(db *sql.DB, key string, revokedAt int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, RevokedChannel, key+" "+strconv.FormatInt(revokedAt, 10))
+	return err
+}
+
+// ListenRevoked adds the revocations sent by NotifyRevoked, from this or any
+// other instance, to d until ctx is cancelled. Revocations sent while the
+// connection is down are lost; the loss is logged, as tokens they revoked stay
+// valid here until they expire.
+func ListenRevoked(ctx context.Context, dsn string, d *Denylist, logger *jsonlog.Logger) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.PrintError(err, map[string]string{"listener": RevokedChannel})
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(RevokedChannel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			if n == nil {
+				logger.PrintError(fmt.Errorf("revocations may have been missed while reconnecting"), map[string]string{"listener": RevokedChannel})
+				continue
+			}
+			key, at, ok := strings.Cut(n.Extra, " ")
+			revokedAt, err := strconv.ParseInt(at, 10, 64)
+			if !ok || err != nil {
+				logger.PrintError(fmt.Errorf("invalid revocation %q", n.Extra), map[string]string{"listener": RevokedChannel})
+				continue
+			}
+			d.Add(key, revokedAt)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package mailer
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		templateFile string
+		data         map[string]any
+		wantSubject  string
+		// wantText must appear in both bodies.
+		wantText string
+	}{
+		{"user_welcome.tmpl", map[string]any{"name": "Aru", "activationToken": "ACTIVATE123", "userID": 7}, "Welcome to the series API!", "ACTIVATE123"},
+		{"password_reset.tmpl", map[string]any{"name": "Aru", "passwordResetToken": "RESET123"}, "Reset your password", "RESET123"},
+		{"email_change.tmpl", map[string]any{"name": "Aru", "email": "new@example.com", "emailChangeToken": "CHANGE123"}, "Confirm your new email address", "CHANGE123"},
+		{"account_unlock.tmpl", map[string]any{"name": "Aru", "unlockToken": "UNLOCK123", "lockedUntil": "later"}, "Your account was locked", "UNLOCK123"},
+		{"notification.tmpl", map[string]any{"name": "Aru", "type": "reply", "episodeID": 3, "commentID": 4}, "New reply to your comment", "comment 4"},
+		{"notification.tmpl", map[string]any{"name": "Aru", "type": "mention", "episodeID": 3, "commentID": 4}, "You were mentioned in a comment", "comment 4"},
+		{"notification.tmpl", map[string]any{"name": "Aru", "type": "favorite_comment", "episodeID": 3, "commentID": 4}, "New comment on one of your favorite episodes", "episode 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantSubject, func(t *testing.T) {
+			msg, err := render("Series <no-reply@example.com>", "aru@example.com", tt.templateFile, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.From != "Series <no-reply@example.com>" || msg.To != "aru@example.com" {
+				t.Errorf("From, To = %q, %q", msg.From, msg.To)
+			}
+			if msg.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tt.wantSubject)
+			}
+			for name, body := range map[string]string{"plain": msg.PlainBody, "HTML": msg.HTMLBody} {
+				if !strings.Contains(body, "Aru") || !strings.Contains(body, tt.wantText) {
+					t.Errorf("%s body lacks the name or %q:\n%s", name, tt.wantText, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	msg, err := render("no-reply@example.com", "aru@example.com", "password_reset.tmpl", map[string]any{
+		"name":               `<script>alert("x")</script>`,
+		"passwordResetToken": "RESET123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.HTMLBody, "<script>") || !strings.Contains(msg.HTMLBody, "&lt;script&gt;") {
+		t.Errorf("HTML body does not escape data:\n%s", msg.HTMLBody)
+	}
+	if !strings.Contains(msg.PlainBody, "<script>") {
+		t.Errorf("plain body escapes data:\n%s", msg.PlainBody)
+	}
+}
+
+func TestRenderMissingTemplate(t *testing.T) {
+	_, err := render("no-reply@example.com", "aru@example.com", "missing.tmpl", nil)
+	if err == nil {
+		t.Error("expected an error for a missing template")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	msg := &Message{
+		From:      "Series <no-reply@example.com>",
+		To:        "aru@example.com",
+		Subject:   "Сәлем, Aru",
+		PlainBody: "Token: abc=def\n" + strings.Repeat("long line ", 20) + "\nКазақша",
+		HTMLBody:  `<p class="x">Token: abc=def</p>`,
+	}
+	raw, err := msg.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := parsed.Header
+	if header.Get("From") != msg.From || header.Get("To") != msg.To {
+		t.Errorf("From, To = %q, %q", header.Get("From"), header.Get("To"))
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, msg.Subject)
+	}
+	if _, err := header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if header.Get("MIME-Version") != "1.0" {
+		t.Errorf("MIME-Version = %q", header.Get("MIME-Version"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v)", header.Get("Content-Type"), err)
+	}
+
+	want := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.PlainBody},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for i := 0; ; i++ {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			if i != len(want) {
+				t.Errorf("%d parts, want %d", i, len(want))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(want) {
+			t.Fatalf("unexpected part %d", i)
+		}
+		if got := part.Header.Get("Content-Type"); got != want[i].contentType {
+			t.Errorf("part %d Content-Type = %q, want %q", i, got, want[i].contentType)
+		}
+		// The reader decodes quoted-printable parts itself.
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Line breaks are sent as CRLF, as email requires.
+		if strings.ReplaceAll(string(body), "\r\n", "\n") != want[i].body {
+			t.Errorf("part %d body = %q, want %q", i, body, want[i].body)
+		}
+	}
+
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 998 {
+			t.Errorf("line longer than SMTP allows: %d bytes", len(line))
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errTemporary := errors.New("temporary failure")
+
+	tests := []struct {
+		name      string
+		attempts  int
+		failures  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"first attempt", 3, 0, 1, false},
+		{"after failures", 3, 2, 3, false},
+		{"gives up", 3, 5, 3, true},
+		{"single attempt", 1, 1, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			start := time.Now()
+			err := retry(tt.attempts, time.Millisecond, func() error {
+				calls++
+				if calls <= tt.failures {
+					return errTemporary
+				}
+				return nil
+			})
+
+			if calls != tt.wantCalls {
+				t.Errorf("%d calls, want %d", calls, tt.wantCalls)
+			}
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, errTemporary)) {
+				t.Errorf("error = %v, want error %v", err, tt.wantErr)
+			}
+			// The waits double: 1ms, 2ms, 4ms...
+			minWait := time.Duration(1<<(tt.wantCalls-1)-1) * time.Millisecond
+			if elapsed := time.Since(start); elapsed < minWait {
+				t.Errorf("took %v, want at least %v", elapsed, minWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// OutboxMailer writes every email into a directory as an .eml file instead of
+// sending it. It is meant for development and tests. The emails carry tokens
+// that grant access to accounts, so only the owner of the process may read
+// them.
+type OutboxMailer struct {
+	dir    string
+	sender string
+	seq    atomic.Int64
+}
+
+func NewOutbox(dir, sender string) (*OutboxMailer, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxMailer{dir: dir, sender: sender}, nil
+}
+
+func (m *OutboxMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.encode()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%d.eml", time.Now().UTC().Format("20060102T150405.000000000"), m.seq.Add(1))
+	return os.WriteFile(filepath.Join(m.dir, name), body, 0o600)
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutboxMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox", "nested")
+	m, err := NewOutbox(dir, "no-reply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o700 {
+		t.Errorf("directory mode = %o, want 700", mode)
+	}
+
+	recipients := []string{"a@example.com", "b@example.com"}
+	for _, recipient := range recipients {
+		err = m.Send(recipient, "password_reset.tmpl", map[string]any{"name": "Aru", "passwordResetToken": "RESET123"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(recipients) {
+		t.Fatalf("%d files written, want %d", len(entries), len(recipients))
+	}
+
+	got := map[string]bool{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".eml") {
+			t.Errorf("file %q is not an .eml file", entry.Name())
+		}
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Reset tokens grant access to accounts.
+		if mode := info.Mode().Perm(); mode != 0o600 {
+			t.Errorf("file mode = %o, want 600", mode)
+		}
+
+		f, err := os.Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := mail.ReadMessage(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[msg.Header.Get("To")] = true
+		if msg.Header.Get("Subject") != "Reset your password" {
+			t.Errorf("Subject = %q", msg.Header.Get("Subject"))
+		}
+	}
+	for _, recipient := range recipients {
+		if !got[recipient] {
+			t.Errorf("no email to %s", recipient)
+		}
+	}
+}
+
+func TestOutboxMailerTemplateError(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewOutbox(dir, "no-reply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Send("a@example.com", "missing.tmpl", nil); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("%d files written for a failed email", len(entries))
+	}
+}
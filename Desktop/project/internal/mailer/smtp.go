@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer delivers emails through an SMTP server, retrying failed
+// deliveries with exponential backoff.
+type SMTPMailer struct {
+	addr     string
+	auth     smtp.Auth
+	sender   string
+	attempts int
+	backoff  time.Duration
+}
+
+// NewSMTP returns an SMTPMailer. Authentication is skipped when username is
+// empty, which suits local SMTP stand-ins.
+func NewSMTP(host string, port int, username, password, sender string, attempts int, backoff time.Duration) *SMTPMailer {
+	m := &SMTPMailer{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		sender:   sender,
+		attempts: max(attempts, 1),
+		backoff:  backoff,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.encode()
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.sender)
+	if err != nil {
+		return err
+	}
+
+	return retry(m.attempts, m.backoff, func() error {
+		return smtp.SendMail(m.addr, m.auth, from.Address, []string{recipient}, body)
+	})
+}
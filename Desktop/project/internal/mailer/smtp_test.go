@@ -0,0 +1,202 @@
+package mailer
+
+import (
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a minimal in-process SMTP server. It turns away the first
+// failFirst connections with a 421 greeting, as a busy server would.
+type smtpServer struct {
+	ln        net.Listener
+	failFirst int
+
+	mu       sync.Mutex
+	conns    int
+	messages []smtpMessage
+}
+
+func newSMTPServer(t *testing.T, failFirst int) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln, failFirst: failFirst}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) hostPort(t *testing.T) (string, int) {
+	host, portStr, err := net.SplitHostPort(s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port
+}
+
+func (s *smtpServer) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *smtpServer) handle(c net.Conn) {
+	defer c.Close()
+	tp := textproto.NewConn(c)
+
+	s.mu.Lock()
+	s.conns++
+	n := s.conns
+	s.mu.Unlock()
+	if n <= s.failFirst {
+		tp.PrintfLine("421 localhost busy, try again later")
+		return
+	}
+
+	tp.PrintfLine("220 localhost ESMTP")
+	var msg smtpMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			msg.from = address(line)
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, address(line))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = smtpMessage{}
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+// address returns the address between angle brackets in a MAIL or RCPT
+// command.
+func address(line string) string {
+	start, end := strings.Index(line, "<"), strings.Index(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+func TestSMTPMailer(t *testing.T) {
+	tests := []struct {
+		name      string
+		failFirst int
+		attempts  int
+		wantConns int
+		wantSent  bool
+	}{
+		{"delivered", 0, 3, 1, true},
+		{"delivered after retries", 2, 3, 3, true},
+		{"gives up", 5, 2, 2, false},
+		{"at least one attempt", 0, 0, 1, true},
+	}
+
+	const backoff = 10 * time.Millisecond
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSMTPServer(t, tt.failFirst)
+			host, port := s.hostPort(t)
+			m := NewSMTP(host, port, "", "", "Series <no-reply@example.com>", tt.attempts, backoff)
+
+			start := time.Now()
+			err := m.Send("aru@example.com", "password_reset.tmpl", map[string]any{"name": "Aru", "passwordResetToken": "RESET123"})
+			elapsed := time.Since(start)
+			if (err == nil) != tt.wantSent {
+				t.Fatalf("Send error = %v, want sent %v", err, tt.wantSent)
+			}
+
+			s.mu.Lock()
+			conns, messages := s.conns, s.messages
+			s.mu.Unlock()
+			if conns != tt.wantConns {
+				t.Errorf("%d connections, want %d", conns, tt.wantConns)
+			}
+			// Waits double from the backoff: 10ms, then 20ms...
+			if minWait := time.Duration(1<<(tt.wantConns-1)-1) * backoff; elapsed < minWait {
+				t.Errorf("took %v, want at least %v", elapsed, minWait)
+			}
+
+			if !tt.wantSent {
+				if len(messages) != 0 {
+					t.Errorf("%d messages delivered, want none", len(messages))
+				}
+				return
+			}
+			if len(messages) != 1 {
+				t.Fatalf("%d messages delivered, want 1", len(messages))
+			}
+			msg := messages[0]
+			if msg.from != "no-reply@example.com" {
+				t.Errorf("MAIL FROM = %q", msg.from)
+			}
+			if len(msg.to) != 1 || msg.to[0] != "aru@example.com" {
+				t.Errorf("RCPT TO = %v", msg.to)
+			}
+			parsed, err := mail.ReadMessage(strings.NewReader(msg.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header.Get("Subject") != "Reset your password" || parsed.Header.Get("From") != "Series <no-reply@example.com>" {
+				t.Errorf("headers = %v", parsed.Header)
+			}
+		})
+	}
+}
+
+func TestSMTPMailerInvalidSender(t *testing.T) {
+	s := newSMTPServer(t, 0)
+	host, port := s.hostPort(t)
+	m := NewSMTP(host, port, "", "", "not an address", 1, 0)
+
+	err := m.Send("aru@example.com", "password_reset.tmpl", map[string]any{"name": "Aru"})
+	if err == nil {
+		t.Error("expected an error for an invalid sender")
+	}
+}
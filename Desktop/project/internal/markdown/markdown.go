@@ -0,0 +1,120 @@
+// Package markdown renders the limited Markdown subset accepted in comments:
+// *emphasis*, **strong**, `code`, fenced code blocks, [links](https://...),
+// > quotes, >! spoiler blocks and ||inline spoilers||.
+//
+// The output is safe to embed in a page: raw HTML outside code blocks is
+// stripped, everything else is escaped, and the renderer only ever emits
+// p, br, em, strong, code, pre, blockquote, a, div and span tags.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	rawTagRX  = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	outTagRX  = regexp.MustCompile(`<[^>]*>`)
+	codeRX    = regexp.MustCompile("`([^`\n]+)`")
+	linkRX    = regexp.MustCompile(`\[([^\]\n]+)\]\(([^)\s]+)\)`)
+	strongRX  = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	emRX      = regexp.MustCompile(`\*([^*\n]+)\*`)
+	spoilerRX = regexp.MustCompile(`\|\|([^|\n]+)\|\|`)
+)
+
+// Render converts comment source into sanitized HTML.
+func Render(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+
+	var out strings.Builder
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>") + "</p>")
+			paragraph = nil
+		}
+	}
+
+	lines := strings.Split(src, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, html.EscapeString(lines[i]))
+			}
+			out.WriteString("<pre><code>" + strings.Join(code, "\n") + "</code></pre>")
+
+		case strings.HasPrefix(trimmed, ">!"):
+			flush()
+			var block []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">!"); i++ {
+				block = append(block, inline(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">!"))))
+			}
+			i--
+			out.WriteString(`<div class="spoiler">` + strings.Join(block, "<br>") + "</div>")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var block []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">") && !strings.HasPrefix(strings.TrimSpace(lines[i]), ">!"); i++ {
+				block = append(block, inline(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"))))
+			}
+			i--
+			out.WriteString("<blockquote>" + strings.Join(block, "<br>") + "</blockquote>")
+
+		case trimmed == "":
+			flush()
+
+		default:
+			paragraph = append(paragraph, inline(trimmed))
+		}
+	}
+	flush()
+
+	return out.String()
+}
+
+// PlainText returns the text a reader sees once the source is rendered.
+func PlainText(src string) string {
+	return html.UnescapeString(outTagRX.ReplaceAllString(Render(src), ""))
+}
+
+func inline(text string) string {
+	text = html.EscapeString(rawTagRX.ReplaceAllString(text, ""))
+
+	// Code spans and link targets are swapped out for placeholders first so
+	// that nothing inside them is treated as markup.
+	var spans []string
+	protect := func(s string) string {
+		spans = append(spans, s)
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	}
+
+	text = codeRX.ReplaceAllStringFunc(text, func(match string) string {
+		return protect("<code>" + codeRX.FindStringSubmatch(match)[1] + "</code>")
+	})
+	text = linkRX.ReplaceAllStringFunc(text, func(match string) string {
+		parts := linkRX.FindStringSubmatch(match)
+		u, err := url.Parse(html.UnescapeString(parts[2]))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return parts[1]
+		}
+		return protect(`<a href="`+html.EscapeString(u.String())+`" rel="nofollow ugc">`) + parts[1] + protect("</a>")
+	})
+	text = strongRX.ReplaceAllString(text, "<strong>$1</strong>")
+	text = emRX.ReplaceAllString(text, "<em>$1</em>")
+	text = spoilerRX.ReplaceAllString(text, `<span class="spoiler">$1</span>`)
+
+	for i, span := range spans {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), span, 1)
+	}
+	return text
+}
@@ -0,0 +1,96 @@
+package markdown
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"paragraphs", "a\r\nb\n\nc", "<p>a<br>b</p><p>c</p>"},
+		{"emphasis", "**bold** *em* ||spoiler||", `<p><strong>bold</strong> <em>em</em> <span class="spoiler">spoiler</span></p>`},
+		{"code span", "`**not bold**`", "<p><code>**not bold**</code></p>"},
+		{"link", "[site](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow ugc">site</a></p>`},
+		{"quote and spoiler block", "> quote\n> more\n>! hidden", `<blockquote>quote<br>more</blockquote><div class="spoiler">hidden</div>`},
+		{"code block", "```\n<script>x</script>\n**a**\n```", "<pre><code>&lt;script&gt;x&lt;/script&gt;\n**a**</code></pre>"},
+		{"comparison is not a tag", "5 < 6 & 7 > 3", "<p>5 &lt; 6 &amp; 7 &gt; 3</p>"},
+		{"script tag", "<script>alert(1)</script>", "<p>alert(1)</p>"},
+		{"raw link", `<a href="javascript:alert(1)">click</a>`, "<p>click</p>"},
+		{"markup in link text", "[<b>x</b>](https://example.com)", `<p><a href="https://example.com" rel="nofollow ugc">x</a></p>`},
+		{"javascript link", "[x](javascript:alert%281%29)", "<p>x</p>"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>"},
+		{"relative link", "[x](//example.com)", "<p>x</p>"},
+		{"entity stays text", "&lt;script&gt;", "<p>&amp;lt;script&amp;gt;</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.src); got != tt.want {
+				t.Errorf("Render(%q)\n got: %s\nwant: %s", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+var (
+	tagRX       = regexp.MustCompile(`<(/?)([^\s>/]*)([^>]*)>`)
+	allowedTags = map[string]bool{"p": true, "br": true, "em": true, "strong": true, "code": true, "pre": true, "blockquote": true, "a": true, "div": true, "span": true}
+	allowedAttr = regexp.MustCompile(`^(?:| class="spoiler"| href="https?://[^"<>]+" rel="nofollow ugc")$`)
+)
+
+// TestRenderSanitizes checks that hostile input only ever produces the tags
+// and attributes the renderer is documented to emit.
+func TestRenderSanitizes(t *testing.T) {
+	inputs := []string{
+		"<img src=x onerror=alert(1)>",
+		"<IMG SRC=x OnError=alert(1)>hi",
+		"<<script>script>alert(1)<</script>/script>",
+		"<svg/onload=alert(1)>",
+		"<iframe src=\"https://example.com\"></iframe>",
+		`[x](https://example.com/"onmouseover="alert(1))`,
+		`[x](https://example.com/'><script>alert(1)</script>)`,
+		"[x](JAVASCRIPT:alert(1))",
+		"[x](https://example.com) **[y](javascript:alert(1))**",
+		"`<script>` ||<b onclick=x>spoiler</b>||",
+		">! <style>body{}</style>\n> <form action=x>",
+		"\x00<script>\x00",
+		"[`a`](https://example.com)\x000\x00",
+	}
+
+	for _, src := range inputs {
+		t.Run(src, func(t *testing.T) {
+			got := Render(src)
+			for _, m := range tagRX.FindAllStringSubmatch(got, -1) {
+				if !allowedTags[m[2]] {
+					t.Errorf("Render(%q) emitted tag %q: %s", src, m[2], got)
+				}
+				if m[1] == "" && !allowedAttr.MatchString(m[3]) {
+					t.Errorf("Render(%q) emitted attributes %q: %s", src, m[3], got)
+				}
+			}
+		})
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"**bold** [link](https://example.com) 5 < 6", "bold link 5 < 6"},
+		{"||spoiler|| <b>x</b>", "spoiler x"},
+		{"```\n<tag>\n```", "<tag>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			if got := PlainText(tt.src); got != tt.want {
+				t.Errorf("PlainText(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package permcache
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"series.bekarysrymkhanov.net/internal/jsonlog"
+)
+
+// Channel is the Postgres notification channel invalidations are sent on.
+// The payload is a user ID, or "*" for every user.
+const Channel = "permissions_changed"
+
+const all = "*"
+
+// Notify asks every instance listening on Channel to drop the entry of the
+// user, or every entry when userID is zero.
+func Notify(db *sql.DB, userID int64) error {
+	payload := all
+	if userID != 0 {
+		payload = strconv.FormatInt(userID, 10)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, Channel, payload)
+	return err
+}
+
+// Listen applies the invalidations sent by Notify, from this or any other
+// instance, to c until ctx is cancelled.
+func Listen(ctx context.Context, dsn string, c *Cache, logger *jsonlog.Logger) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.PrintError(err, map[string]string{"listener": Channel})
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(Channel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification follows a reconnect, during which
+			// notifications may have been lost.
+			if n == nil || n.Extra == all {
+				c.InvalidateAll()
+				continue
+			}
+			userID, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				c.InvalidateAll()
+				continue
+			}
+			c.Invalidate(userID)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package permcache caches the effective permissions of users in process, so
+// that authorizing a request does not query the database every time.
+package permcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"series.bekarysrymkhanov.net/internal/data"
+)
+
+// Loader fetches the effective permissions of a user from the database.
+type Loader func(userID int64) (data.Permissions, error)
+
+type entry struct {
+	permissions data.Permissions
+	expiry      time.Time
+}
+
+// Stats are the counters exposed as metrics.
+type Stats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Invalidations int64 `json:"invalidations"`
+	Entries       int   `json:"entries"`
+}
+
+// Cache holds permissions for up to ttl. Entries are also dropped explicitly
+// whenever the grants, roles or state of their user change, so the ttl only
+// bounds staleness when an invalidation is missed.
+type Cache struct {
+	ttl  time.Duration
+	load Loader
+
+	mu      sync.Mutex
+	entries map[int64]entry
+	// generation is bumped by every invalidation, so that a load which
+	// raced with one does not store what it read before it.
+	generation uint64
+
+	hits, misses, invalidations atomic.Int64
+}
+
+// New returns a cache that loads missing entries with load. A ttl of zero
+// disables caching.
+func New(ttl time.Duration, load Loader) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		load:    load,
+		entries: make(map[int64]entry),
+	}
+}
+
+func (c *Cache) Get(userID int64) (data.Permissions, error) {
+	c.mu.Lock()
+	e, ok := c.entries[userID]
+	generation := c.generation
+	c.mu.Unlock()
+
+	if ok && time.Now().Before(e.expiry) {
+		c.hits.Add(1)
+		return e.permissions, nil
+	}
+	c.misses.Add(1)
+
+	permissions, err := c.load(userID)
+	if err != nil {
+		return nil, err
+	}
+	if c.ttl <= 0 {
+		return permissions, nil
+	}
+
+	c.mu.Lock()
+	if c.generation == generation {
+		c.entries[userID] = entry{permissions: permissions, expiry: time.Now().Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return permissions, nil
+}
+
+// Invalidate drops the entry of the user.
+func (c *Cache) Invalidate(userID int64) {
+	c.invalidations.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.entries, userID)
+}
+
+// InvalidateAll drops every entry, as needed when a role changes or when
+// invalidations may have been missed.
+func (c *Cache) InvalidateAll() {
+	c.invalidations.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	clear(c.entries)
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+		Entries:       entries,
+	}
+}
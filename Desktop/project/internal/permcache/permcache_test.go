@@ -0,0 +1,167 @@
+package permcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"series.bekarysrymkhanov.net/internal/data"
+)
+
+// countingLoader returns the permissions of a user and counts its calls.
+type countingLoader struct {
+	permissions map[int64]data.Permissions
+	calls       int
+	err         error
+	// during runs inside the load, as a concurrent request would.
+	during func()
+}
+
+func (l *countingLoader) load(userID int64) (data.Permissions, error) {
+	l.calls++
+	if l.during != nil {
+		l.during()
+	}
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.permissions[userID], nil
+}
+
+func newLoader() *countingLoader {
+	return &countingLoader{permissions: map[int64]data.Permissions{
+		1: {"series:read"},
+		2: {"series:read", "series:write"},
+	}}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		steps func(c *Cache)
+		// wantCalls is how often the loader ran during the steps.
+		wantCalls int
+		wantStats Stats
+	}{
+		{"cached", time.Minute, func(c *Cache) {
+			c.Get(1)
+			c.Get(1)
+			c.Get(1)
+		}, 1, Stats{Hits: 2, Misses: 1, Entries: 1}},
+		{"per user", time.Minute, func(c *Cache) {
+			c.Get(1)
+			c.Get(2)
+			c.Get(2)
+		}, 2, Stats{Hits: 1, Misses: 2, Entries: 2}},
+		{"ttl of zero", 0, func(c *Cache) {
+			c.Get(1)
+			c.Get(1)
+		}, 2, Stats{Misses: 2}},
+		{"expired", 10 * time.Millisecond, func(c *Cache) {
+			c.Get(1)
+			time.Sleep(20 * time.Millisecond)
+			c.Get(1)
+		}, 2, Stats{Misses: 2, Entries: 1}},
+		{"invalidate", time.Minute, func(c *Cache) {
+			c.Get(1)
+			c.Get(2)
+			c.Invalidate(1)
+			c.Get(1)
+			c.Get(2)
+		}, 3, Stats{Hits: 1, Misses: 3, Invalidations: 1, Entries: 2}},
+		{"invalidate all", time.Minute, func(c *Cache) {
+			c.Get(1)
+			c.Get(2)
+			c.InvalidateAll()
+		}, 2, Stats{Misses: 2, Invalidations: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLoader()
+			c := New(tt.ttl, l.load)
+			tt.steps(c)
+
+			if l.calls != tt.wantCalls {
+				t.Errorf("loader ran %d times, want %d", l.calls, tt.wantCalls)
+			}
+			if got := c.Stats(); got != tt.wantStats {
+				t.Errorf("Stats = %+v, want %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestGetReturnsPermissions(t *testing.T) {
+	c := New(time.Minute, newLoader().load)
+
+	for i := 0; i < 2; i++ {
+		permissions, err := c.Get(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !permissions.Include("series:write") || len(permissions) != 2 {
+			t.Errorf("Get = %v, want the permissions of user 2", permissions)
+		}
+	}
+}
+
+func TestGetLoaderError(t *testing.T) {
+	l := newLoader()
+	l.err = errors.New("database down")
+	c := New(time.Minute, l.load)
+
+	_, err := c.Get(1)
+	if !errors.Is(err, l.err) {
+		t.Fatalf("Get error = %v, want %v", err, l.err)
+	}
+
+	// The failure must not be cached.
+	l.err = nil
+	permissions, err := c.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !permissions.Include("series:read") {
+		t.Errorf("Get = %v after the loader recovered", permissions)
+	}
+	if l.calls != 2 {
+		t.Errorf("loader ran %d times, want 2", l.calls)
+	}
+}
+
+func TestInvalidateDuringLoad(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(c *Cache)
+	}{
+		{"same user", func(c *Cache) { c.Invalidate(1) }},
+		{"other user", func(c *Cache) { c.Invalidate(2) }},
+		{"everyone", func(c *Cache) { c.InvalidateAll() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLoader()
+			c := New(time.Minute, l.load)
+			l.during = func() {
+				l.during = nil
+				tt.invalidate(c)
+			}
+
+			// What the racing load read may predate the invalidation, so it
+			// is returned but not stored.
+			c.Get(1)
+			if got := c.Stats().Entries; got != 0 {
+				t.Errorf("%d entries stored after a racing load, want 0", got)
+			}
+
+			c.Get(1)
+			c.Get(1)
+			if l.calls != 2 {
+				t.Errorf("loader ran %d times, want 2", l.calls)
+			}
+		})
+	}
+}
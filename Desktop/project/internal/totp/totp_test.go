@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded.
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestGenerateRFC6238(t *testing.T) {
+	// The vectors have eight digits; ours are their last six.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		counter := tt.unix / int64(Period.Seconds())
+		if got := generate([]byte("12345678901234567890"), counter); got != tt.want {
+			t.Errorf("generate at %d = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter := now.Unix() / int64(Period.Seconds())
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		name        string
+		secret      string
+		code        string
+		wantOK      bool
+		wantCounter int64
+	}{
+		{"current period", rfcSecret, generate(key, counter), true, counter},
+		{"previous period", rfcSecret, generate(key, counter-1), true, counter - 1},
+		{"next period", rfcSecret, generate(key, counter+1), true, counter + 1},
+		{"two periods ago", rfcSecret, generate(key, counter-2), false, 0},
+		{"two periods ahead", rfcSecret, generate(key, counter+2), false, 0},
+		{"lower case secret", strings.ToLower(rfcSecret), generate(key, counter), true, counter},
+		{"wrong code", rfcSecret, "000000", false, 0},
+		{"too short", rfcSecret, "05047", false, 0},
+		{"too long", rfcSecret, "0050471", false, 0},
+		{"invalid secret", "not base32!", generate(key, counter), false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(tt.secret, tt.code, now)
+			if ok != tt.wantOK || got != tt.wantCounter {
+				t.Errorf("Validate = (%d, %v), want (%d, %v)", got, ok, tt.wantCounter, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not base32: %v", secret, err)
+	}
+	if len(key) != 20 {
+		t.Errorf("secret has %d bytes, want 20", len(key))
+	}
+
+	other, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == other {
+		t.Error("two secrets are equal")
+	}
+}
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code = 'comments:moderate';
+ALTER TABLE like_comment DROP CONSTRAINT IF EXISTS like_comment_user_id_fkey;
+ALTER TABLE like_comment ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE like_comment ALTER COLUMN user_id TYPE integer;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar;
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar text NOT NULL DEFAULT '';
+
+-- Comments whose author no longer exists cannot be shown, so they are dropped
+-- rather than blocking the foreign key.
+DELETE FROM like_comment
+WHERE user_id IS NULL OR NOT EXISTS (SELECT 1 FROM users WHERE users.id = like_comment.user_id);
+
+-- Users are anonymized rather than deleted, so deleting one that still has
+-- comments is refused instead of taking the comments with it.
+ALTER TABLE like_comment ALTER COLUMN user_id TYPE bigint;
+ALTER TABLE like_comment ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE like_comment ADD CONSTRAINT like_comment_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+
+INSERT INTO permissions (code)
+VALUES
+    ('comments:moderate');
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS moderation_log;
+DROP TABLE IF EXISTS comment_reports;
+DROP INDEX IF EXISTS like_comment_status_idx;
+ALTER TABLE like_comment DROP CONSTRAINT IF EXISTS like_comment_status_check;
+ALTER TABLE like_comment DROP COLUMN IF EXISTS status;
+ALTER TABLE users DROP COLUMN IF EXISTS banned;
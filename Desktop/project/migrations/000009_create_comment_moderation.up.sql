@@ -0,0 +1,24 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS banned bool NOT NULL DEFAULT false;
+
+ALTER TABLE like_comment ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'visible';
+ALTER TABLE like_comment ADD CONSTRAINT like_comment_status_check CHECK (status IN ('visible', 'flagged', 'hidden'));
+CREATE INDEX IF NOT EXISTS like_comment_status_idx ON like_comment (status);
+
+CREATE TABLE IF NOT EXISTS comment_reports (
+    id bigserial PRIMARY KEY,
+    comment_id bigint NOT NULL REFERENCES like_comment ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    reason text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (comment_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS moderation_log (
+    id bigserial PRIMARY KEY,
+    moderator_id bigint REFERENCES users ON DELETE SET NULL,
+    comment_id bigint NOT NULL,
+    author_id bigint NOT NULL,
+    action text NOT NULL,
+    reason text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS comment_reactions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    comment_id bigint NOT NULL REFERENCES like_comment ON DELETE CASCADE,
+    emoji text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, comment_id, emoji)
+);
+CREATE INDEX IF NOT EXISTS comment_reactions_comment_id_idx ON comment_reactions (comment_id);
+
+CREATE TABLE IF NOT EXISTS episode_reactions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    episode_id bigint NOT NULL REFERENCES episodes ON DELETE CASCADE,
+    emoji text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, episode_id, emoji)
+);
+CREATE INDEX IF NOT EXISTS episode_reactions_episode_id_idx ON episode_reactions (episode_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notifications;
+DROP INDEX IF EXISTS like_comment_parent_id_idx;
+ALTER TABLE like_comment DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,21 @@
+ALTER TABLE like_comment ADD COLUMN IF NOT EXISTS parent_id bigint REFERENCES like_comment ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS like_comment_parent_id_idx ON like_comment (parent_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    type text NOT NULL,
+    actor_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    comment_id bigint NOT NULL REFERENCES like_comment ON DELETE CASCADE,
+    episode_id bigint NOT NULL REFERENCES episodes ON DELETE CASCADE,
+    read_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    type text NOT NULL,
+    muted bool NOT NULL DEFAULT false,
+    PRIMARY KEY (user_id, type)
+);
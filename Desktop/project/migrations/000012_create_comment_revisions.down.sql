@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS comment_revisions;
+ALTER TABLE like_comment DROP COLUMN IF EXISTS edit_count;
+ALTER TABLE like_comment DROP COLUMN IF EXISTS edited_at;
@@ -0,0 +1,11 @@
+ALTER TABLE like_comment ADD COLUMN IF NOT EXISTS edited_at timestamp(0) with time zone;
+ALTER TABLE like_comment ADD COLUMN IF NOT EXISTS edit_count integer NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS comment_revisions (
+    id bigserial PRIMARY KEY,
+    comment_id bigint NOT NULL REFERENCES like_comment ON DELETE CASCADE,
+    editor_id bigint REFERENCES users ON DELETE SET NULL,
+    comment_text text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS comment_revisions_comment_id_idx ON comment_revisions (comment_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS watched_episodes;
+ALTER TABLE like_comment DROP COLUMN IF EXISTS spoiler_episode_id;
@@ -0,0 +1,8 @@
+ALTER TABLE like_comment ADD COLUMN IF NOT EXISTS spoiler_episode_id bigint REFERENCES episodes(id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS watched_episodes (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    episode_id bigint NOT NULL REFERENCES episodes ON DELETE CASCADE,
+    watched_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, episode_id)
+);
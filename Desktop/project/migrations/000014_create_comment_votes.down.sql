@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS like_comment_episode_id_created_at_idx;
+DROP TABLE IF EXISTS comment_votes;
+ALTER TABLE like_comment DROP COLUMN IF EXISTS pinned;
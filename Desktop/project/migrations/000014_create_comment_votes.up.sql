@@ -0,0 +1,11 @@
+ALTER TABLE like_comment ADD COLUMN IF NOT EXISTS pinned bool NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS comment_votes (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    comment_id bigint NOT NULL REFERENCES like_comment ON DELETE CASCADE,
+    value smallint NOT NULL CHECK (value IN (-1, 1)),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, comment_id)
+);
+CREATE INDEX IF NOT EXISTS comment_votes_comment_id_idx ON comment_votes (comment_id);
+CREATE INDEX IF NOT EXISTS like_comment_episode_id_created_at_idx ON like_comment (episode_id, created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tokens_session_id_idx;
+ALTER TABLE tokens DROP COLUMN IF EXISTS session_id;
+DROP TABLE IF EXISTS sessions;
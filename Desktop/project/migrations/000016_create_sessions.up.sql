@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    user_agent text NOT NULL DEFAULT '',
+    ip text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_used_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+-- A session groups the tokens of a login, and refresh tokens are rotated
+-- within it.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS session_id bigint REFERENCES sessions ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS tokens_session_id_idx ON tokens (session_id);
+
+-- Tokens issued before sessions existed are moved into one session per user,
+-- so that they can still be refreshed and revoked.
+INSERT INTO sessions (user_id)
+SELECT DISTINCT user_id FROM tokens
+WHERE scope IN ('authentication', 'refresh') AND session_id IS NULL;
+
+UPDATE tokens
+SET session_id = sessions.id
+FROM sessions
+WHERE tokens.user_id = sessions.user_id
+AND tokens.scope IN ('authentication', 'refresh') AND tokens.session_id IS NULL;
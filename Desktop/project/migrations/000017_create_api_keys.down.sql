@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'service-accounts:manage';
+DROP TABLE IF EXISTS api_keys;
+ALTER TABLE users DROP COLUMN IF EXISTS service_account;
@@ -0,0 +1,19 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS service_account bool NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    hash bytea NOT NULL UNIQUE,
+    permissions text[] NOT NULL DEFAULT '{}',
+    allowed_ips text[] NOT NULL DEFAULT '{}',
+    expiry timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_used_at timestamp(0) with time zone,
+    UNIQUE (user_id, name)
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('service-accounts:manage');
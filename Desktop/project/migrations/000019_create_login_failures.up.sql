@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+    email citext PRIMARY KEY,
+    failures integer NOT NULL DEFAULT 0,
+    locked_until timestamp(0) with time zone,
+    last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('users:manage');
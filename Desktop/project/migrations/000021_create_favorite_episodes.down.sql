@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS favoriteEpisodes integer[];
+
+UPDATE users
+SET favoriteEpisodes = favorites.episode_ids
+FROM (
+    SELECT user_id, array_agg(episode_id::integer ORDER BY created_at) AS episode_ids
+    FROM favorite_episodes
+    GROUP BY user_id
+) AS favorites
+WHERE users.id = favorites.user_id;
+
+DROP TABLE IF EXISTS favorite_episodes;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS favorite_episodes (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    episode_id bigint NOT NULL REFERENCES episodes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, episode_id)
+);
+CREATE INDEX IF NOT EXISTS favorite_episodes_episode_id_idx ON favorite_episodes (episode_id);
+
+INSERT INTO favorite_episodes (user_id, episode_id)
+SELECT DISTINCT users.id, favorites.episode_id
+FROM users
+CROSS JOIN LATERAL unnest(users.favoriteEpisodes) AS favorites(episode_id)
+WHERE EXISTS (SELECT 1 FROM episodes WHERE episodes.id = favorites.episode_id)
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users DROP COLUMN IF EXISTS favoriteEpisodes;
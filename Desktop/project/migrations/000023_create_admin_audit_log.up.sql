@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id bigserial PRIMARY KEY,
+    actor_id bigint REFERENCES users ON DELETE SET NULL,
+    target_user_id bigint REFERENCES users ON DELETE SET NULL,
+    action text NOT NULL,
+    details jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS admin_audit_log_target_user_id_idx ON admin_audit_log (target_user_id, created_at);
@@ -0,0 +1,26 @@
+-- Expand the roles, and any wildcard grants, into the plain codes they cover.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT DISTINCT grants.user_id, covered.id
+FROM (
+    SELECT users_roles.user_id, roles_permissions.permission_id
+    FROM users_roles
+    INNER JOIN roles_permissions ON roles_permissions.role_id = users_roles.role_id
+    UNION
+    SELECT user_id, permission_id
+    FROM users_permissions
+) AS grants
+INNER JOIN permissions granted ON granted.id = grants.permission_id
+INNER JOIN permissions covered ON covered.code LIKE replace(granted.code, '*', '%')
+WHERE covered.code NOT LIKE '%*'
+ON CONFLICT DO NOTHING;
+
+DROP TABLE IF EXISTS users_roles;
+DROP TABLE IF EXISTS roles_permissions;
+DROP TABLE IF EXISTS roles;
+
+DELETE FROM permissions WHERE code IN ('episodes:*', 'comments:*', '*');
+ALTER TABLE permissions DROP CONSTRAINT IF EXISTS permissions_code_key;
+
+UPDATE api_keys SET permissions = array_replace(array_replace(permissions, 'episodes:read', 'movies:read'), 'episodes:write', 'movies:write');
+UPDATE permissions SET code = 'movies:read' WHERE code = 'episodes:read';
+UPDATE permissions SET code = 'movies:write' WHERE code = 'episodes:write';
@@ -0,0 +1,64 @@
+-- The movies:* codes predate the episodes naming. Stored grants move to the
+-- new codes; the application still accepts the old ones as aliases.
+UPDATE permissions SET code = 'episodes:read' WHERE code = 'movies:read';
+UPDATE permissions SET code = 'episodes:write' WHERE code = 'movies:write';
+UPDATE api_keys SET permissions = array_replace(array_replace(permissions, 'movies:read', 'episodes:read'), 'movies:write', 'episodes:write');
+
+ALTER TABLE permissions ADD CONSTRAINT permissions_code_key UNIQUE (code);
+
+INSERT INTO permissions (code)
+VALUES
+    ('episodes:*'),
+    ('comments:*'),
+    ('*')
+ON CONFLICT (code) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    name text UNIQUE NOT NULL,
+    description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name, description)
+VALUES
+    ('viewer', 'Can browse episodes'),
+    ('editor', 'Can create and edit episodes'),
+    ('moderator', 'Can browse episodes and moderate comments'),
+    ('admin', 'Can do everything');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM (VALUES
+    ('viewer', 'episodes:read'),
+    ('editor', 'episodes:*'),
+    ('moderator', 'episodes:read'),
+    ('moderator', 'comments:*'),
+    ('admin', '*')
+) AS grants (role, code)
+INNER JOIN roles ON roles.name = grants.role
+INNER JOIN permissions ON permissions.code = grants.code;
+
+-- Every user was given episodes:read on registration, which the viewer role
+-- now bundles.
+INSERT INTO users_roles (user_id, role_id)
+SELECT users_permissions.user_id, roles.id
+FROM users_permissions
+INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+CROSS JOIN roles
+WHERE permissions.code = 'episodes:read' AND roles.name = 'viewer';
+
+DELETE FROM users_permissions
+USING permissions
+WHERE users_permissions.permission_id = permissions.id AND permissions.code = 'episodes:read';
@@ -0,0 +1,4 @@
+INSERT INTO permissions (code)
+VALUES
+    ('metrics:view')
+ON CONFLICT (code) DO NOTHING;
@@ -0,0 +1,5 @@
+DELETE FROM tokens WHERE oauth_client_id IS NOT NULL;
+DROP INDEX IF EXISTS tokens_oauth_client_id_idx;
+ALTER TABLE tokens DROP COLUMN IF EXISTS permissions;
+ALTER TABLE tokens DROP COLUMN IF EXISTS oauth_client_id;
+DROP TABLE IF EXISTS oauth_clients;
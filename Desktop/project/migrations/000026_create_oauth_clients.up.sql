@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    client_id text NOT NULL UNIQUE,
+    secret_hash bytea NOT NULL,
+    scopes text[] NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_used_at timestamp(0) with time zone,
+    UNIQUE (user_id, name)
+);
+
+-- Tokens issued to a client are limited to the scopes granted with them and
+-- revoked along with the client.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS oauth_client_id bigint REFERENCES oauth_clients ON DELETE CASCADE;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS permissions text[];
+CREATE INDEX IF NOT EXISTS tokens_oauth_client_id_idx ON tokens (oauth_client_id);
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username citext UNIQUE;
+
+-- Names that were already mentionable become usernames, so existing @mentions
+-- of them keep working.
+UPDATE users
+SET username = name
+WHERE NOT anonymized
+AND length(name) BETWEEN 3 AND 30
+AND name ~ '^[a-zA-Z0-9_]([a-zA-Z0-9_.-]*[a-zA-Z0-9_])?$'
+AND lower(name) IN (
+    SELECT lower(name)
+    FROM users
+    GROUP BY lower(name)
+    HAVING count(*) = 1
+);